@@ -0,0 +1,182 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"kvstore/index"
+	"kvstore/store"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBatchCommitted 批量写入已经提交
+var ErrBatchCommitted = errors.New("kvstore: batch has been committed")
+
+// 批量写入编号, 以启动时间为初始值保证重启后不重复
+var batchSeq = uint64(time.Now().UnixNano())
+
+// WriteBatch 批量写入, 提交时所有操作作为一个整体写入文件, 重放时要么全部生效要么全部丢弃
+type WriteBatch struct {
+	kv        *Kvstore
+	entries   []*store.Entry
+	committed bool
+}
+
+// NewWriteBatch 建立批量写入
+func (k *Kvstore) NewWriteBatch() *WriteBatch {
+	return &WriteBatch{kv: k}
+}
+
+// Put 设置str值
+func (b *WriteBatch) Put(key, value []byte) error {
+	if b.committed {
+		return ErrBatchCommitted
+	}
+	// 检查数据是否合法
+	if err := b.kv.checkKeyValue(key, value); err != nil {
+		return err
+	}
+	b.entries = append(b.entries, store.NewNoExtraEntry(key, value, String, StringSet))
+	return nil
+}
+
+// Delete 删除str值
+func (b *WriteBatch) Delete(key []byte) error {
+	if b.committed {
+		return ErrBatchCommitted
+	}
+	// 检查数据是否合法
+	if err := b.kv.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	b.entries = append(b.entries, store.NewNoExtraEntry(key, nil, String, StringRem))
+	return nil
+}
+
+// Len 返回批量写入中操作的数量
+func (b *WriteBatch) Len() int {
+	return len(b.entries)
+}
+
+// Commit 提交批量写入
+func (b *WriteBatch) Commit() error {
+	if b.committed {
+		return ErrBatchCommitted
+	}
+	if len(b.entries) == 0 {
+		b.committed = true
+		return nil
+	}
+	k := b.kv
+
+	// 加锁, 提交期间读操作看不到部分生效的结果
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	defer k.flushIndex()
+
+	// 内存不足时按照淘汰策略淘汰其他键
+	if err := k.freeMemory(b.entries...); err != nil {
+		return err
+	}
+
+	// 以起止标记包裹所有操作, 起始标记的额外信息记录操作数量
+	id := newBatchId()
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(len(b.entries)))
+	entries := make([]*store.Entry, 0, len(b.entries)+2)
+	entries = append(entries, store.NewEntry(id, nil, count, Batch, BatchBegin))
+	entries = append(entries, b.entries...)
+	entries = append(entries, store.NewNoExtraEntry(id, nil, Batch, BatchCommit))
+
+	// 写入文件, 提交标记没有写入时尽量写入终止标记, 避免之后的数据被当作该批量写入的一部分
+	// 提交标记已经写入时重放会应用该批量写入, 只是同步失败, 仍然更新索引表并返回错误
+	indexes, err := k.storeBatch(entries...)
+	if err != nil && len(indexes) < len(entries) {
+		// 已经写入的操作重放时会被丢弃, 与重放一样记为垃圾数据
+		if len(indexes) > 1 {
+			k.discardBatch(&pendingBatch{entries: b.entries[:len(indexes)-1], indexes: indexes[1:]})
+		}
+		_ = k.store(store.NewNoExtraEntry(id, nil, Batch, BatchAbort))
+		return err
+	}
+
+	// 更新索引表信息
+	for i, e := range b.entries {
+		k.saveVersion(e.Meta.Key)
+		switch e.Mark {
+		case StringSet:
+			k.setIndexer(indexes[i+1])
+		case StringRem:
+			k.removeIndexer(e.Meta.Key)
+		}
+		k.clearExpire(e.Meta.Key)
+	}
+	b.committed = true
+	return err
+}
+
+// 生成批量写入编号
+func newBatchId() []byte {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, atomic.AddUint64(&batchSeq, 1))
+	return id
+}
+
+// 重放时尚未提交的批量写入
+type pendingBatch struct {
+	id      []byte
+	count   uint32
+	entries []*store.Entry
+	indexes []*index.Indexer
+}
+
+func (p *pendingBatch) add(e *store.Entry, idx *index.Indexer) {
+	p.entries = append(p.entries, e)
+	p.indexes = append(p.indexes, idx)
+}
+
+// 重放批量写入标记, 返回重放之后尚未提交的批量写入
+func (k *Kvstore) replayBatch(batch *pendingBatch, e *store.Entry) *pendingBatch {
+	switch e.Mark {
+	case BatchBegin:
+		if batch != nil {
+			log.Printf("discard uncommitted batch with %d entries\n", len(batch.entries))
+			k.discardBatch(batch)
+		}
+		var count uint32
+		if len(e.Meta.Extra) == 4 {
+			count = binary.BigEndian.Uint32(e.Meta.Extra)
+		}
+		return &pendingBatch{id: e.Meta.Key, count: count}
+	case BatchCommit:
+		// 编号和数量都一致才算完整提交
+		if batch != nil && bytes.Equal(batch.id, e.Meta.Key) && int(batch.count) == len(batch.entries) {
+			for i, be := range batch.entries {
+				k.buildIndex(be, batch.indexes[i])
+			}
+		} else if batch != nil {
+			log.Printf("discard broken batch with %d entries\n", len(batch.entries))
+			k.discardBatch(batch)
+		}
+	case BatchAbort:
+		// 写入失败时追加的终止标记, 编号一致的批量写入整体丢弃
+		if batch != nil && bytes.Equal(batch.id, e.Meta.Key) {
+			k.discardBatch(batch)
+		} else if batch != nil {
+			log.Printf("discard broken batch with %d entries\n", len(batch.entries))
+			k.discardBatch(batch)
+		}
+	}
+	return nil
+}
+
+// 丢弃未提交的批量写入, 其中的entry记为失效, 写入时即为失效的entry已经计入垃圾数据
+func (k *Kvstore) discardBatch(batch *pendingBatch) {
+	for i, idx := range batch.indexes {
+		if trackedEntry(batch.entries[i]) {
+			k.addGarbage(idx)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package kvstore
+
+import (
+	"kvstore/store"
+	"testing"
+)
+
+// 所有数据文件中的数据都已失效
+func checkAllGarbage(t *testing.T, kv *Kvstore) {
+	t.Helper()
+	kv.stats.mu.Lock()
+	defer kv.stats.mu.Unlock()
+	for fid, st := range kv.stats.files {
+		if st.Total == 0 || st.Garbage != st.Total {
+			t.Fatalf("file %d: garbage %d, total %d", fid, st.Garbage, st.Total)
+		}
+	}
+}
+
+func TestReplayBatchAbort(t *testing.T) {
+	config := testConfig(t)
+	kv := openTestKv(t, config)
+
+	// 模拟提交时写入失败, 起始标记和部分操作之后是终止标记
+	id := newBatchId()
+	_, err := kv.storeBatch(
+		store.NewEntry(id, nil, []byte{0, 0, 0, 2}, Batch, BatchBegin),
+		store.NewNoExtraEntry([]byte("k"), []byte("v"), String, StringSet),
+		store.NewNoExtraEntry(id, nil, Batch, BatchAbort),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv = reopenTestKv(t, kv, config)
+	defer kv.Close()
+	if _, err := kv.Get([]byte("k")); err != ErrKeyNotExist {
+		t.Fatalf("get aborted key: got %v, want %v", err, ErrKeyNotExist)
+	}
+	checkAllGarbage(t, kv)
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Policy 缓存的淘汰策略
+type Policy int8
+
+const (
+	// LRU 淘汰最久未使用的元素
+	LRU Policy = iota
+	// LFU 按最久未使用的顺序淘汰, 但新元素的访问频率不高于被淘汰的元素时不放入缓存(TinyLFU)
+	LFU
+)
+
+// Stats 缓存的统计信息
+type Stats struct {
+	// Hits 命中次数
+	Hits uint64
+	// Misses 未命中次数
+	Misses uint64
+	// Evictions 因为容量不足被淘汰的元素数量
+	Evictions uint64
+	// Rejections 访问频率较低而没有放入缓存的元素数量
+	Rejections uint64
+	// Items 缓存的元素数量
+	Items int
+	// Size 缓存的元素占用的大小
+	Size int64
+	// Capacity 容量上限
+	Capacity int64
+}
+
+// HitRatio 命中率
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// 每个元素额外占用的大小估计
+const itemOverhead = 64
+
+// Cache 按大小限制容量的值缓存, 并发安全
+// 每个元素带有一个可比较的标记, 查找时标记不一致视为未命中, 用于区分同一个键的不同版本
+type Cache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	items    map[string]*list.Element
+	lru      *list.List
+	// 访问频率的估计, 只在LFU策略下使用
+	sketch *sketch
+	stats  Stats
+}
+
+type item struct {
+	key   string
+	tag   interface{}
+	value []byte
+	cost  int64
+}
+
+// New 新建容量为capacity的缓存
+func New(capacity int64, policy Policy) *Cache {
+	c := &Cache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if policy == LFU {
+		c.sketch = newSketch(capacity)
+	}
+	return c
+}
+
+// Get 查找标记为tag的元素
+func (c *Cache) Get(key string, tag interface{}) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sketch != nil {
+		c.sketch.increment(key)
+	}
+	e, exist := c.items[key]
+	if !exist || e.Value.(*item).tag != tag {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*item).value, true
+}
+
+// Set 放入元素, 同一个键原来的元素被替换, 返回是否放入缓存
+func (c *Cache) Set(key string, tag interface{}, value []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, exist := c.items[key]; exist {
+		c.remove(e)
+	}
+	cost := int64(len(key)+len(value)) + itemOverhead
+	if cost > c.capacity {
+		return false
+	}
+
+	// 容量不足时淘汰最久未使用的元素, LFU策略下新元素的访问频率需要高于所有被淘汰的元素
+	// 先选出需要淘汰的元素, 决定放入之后再淘汰, 拒绝时缓存保持不变
+	var victims []*list.Element
+	free := c.capacity - c.size
+	for e := c.lru.Back(); free < cost; e = e.Prev() {
+		victim := e.Value.(*item)
+		if c.sketch != nil && c.sketch.estimate(key) <= c.sketch.estimate(victim.key) {
+			c.stats.Rejections++
+			return false
+		}
+		victims = append(victims, e)
+		free += victim.cost
+	}
+	for _, e := range victims {
+		c.remove(e)
+		c.stats.Evictions++
+	}
+
+	c.items[key] = c.lru.PushFront(&item{key: key, tag: tag, value: value, cost: cost})
+	c.size += cost
+	return true
+}
+
+// Remove 删除元素
+func (c *Cache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, exist := c.items[key]; exist {
+		c.remove(e)
+	}
+}
+
+// Purge 清空缓存, 统计信息保留
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+// Stats 返回统计信息
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := c.stats
+	st.Items = len(c.items)
+	st.Size = c.size
+	st.Capacity = c.capacity
+	return st
+}
+
+func (c *Cache) remove(e *list.Element) {
+	it := c.lru.Remove(e).(*item)
+	delete(c.items, it.key)
+	c.size -= it.cost
+}
@@ -0,0 +1,82 @@
+package cache
+
+import "hash/fnv"
+
+const (
+	// 计数的行数, 估计值取各行中的最小值
+	sketchDepth = 4
+	// 计数的上限
+	maxCount = 15
+	// 估计缓存元素数量时假设的平均大小
+	averageItemSize = 256
+)
+
+// count-min sketch, 用较小的空间估计键的访问频率
+// 访问次数达到采样上限时所有计数减半, 使频率的估计偏向最近的访问
+type sketch struct {
+	rows [sketchDepth][]uint8
+	mask uint64
+	// 距离上次减半的访问次数
+	additions  int
+	sampleSize int
+}
+
+// 根据缓存的容量估计元素数量, 计数的宽度取不小于该数量的2的幂
+func newSketch(capacity int64) *sketch {
+	width := 1024
+	for int64(width)*averageItemSize < capacity && width < 1<<24 {
+		width <<= 1
+	}
+
+	s := &sketch{mask: uint64(width - 1), sampleSize: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// 记录一次访问
+func (s *sketch) increment(key string) {
+	h1, h2 := hashKey(key)
+	for i := range s.rows {
+		j := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][j] < maxCount {
+			s.rows[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// 估计访问次数
+func (s *sketch) estimate(key string) uint8 {
+	h1, h2 := hashKey(key)
+	min := uint8(maxCount)
+	for i := range s.rows {
+		if c := s.rows[i][(h1+uint64(i)*h2)&s.mask]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// 所有计数减半
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// 由一个64位哈希值得到两个哈希值, 每行的位置为h1 + i*h2
+func hashKey(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum, sum>>32 | sum<<32 | 1
+}
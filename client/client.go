@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"kvstore/proto"
+	"net"
+	"time"
+)
+
+var (
+	// ErrNil 键或字段不存在
+	ErrNil = errors.New("kvstore: nil")
+
+	// ErrClosed 客户端已经关闭
+	ErrClosed = errors.New("kvstore: client is closed")
+
+	// ErrUnexpectedReply 回复的类型与命令不符
+	ErrUnexpectedReply = errors.New("kvstore: unexpected reply type")
+)
+
+const (
+	// DefaultAddr 默认的服务器地址
+	DefaultAddr = "127.0.0.1:5000"
+
+	// DefaultPoolSize 默认的连接数量上限
+	DefaultPoolSize = 10
+
+	// DefaultDialTimeout 默认的建立连接超时时间
+	DefaultDialTimeout = 5 * time.Second
+
+	// DefaultIdleCheckInterval 连接空闲超过该时间后, 使用前需要检查是否可用
+	DefaultIdleCheckInterval = time.Minute
+
+	// DefaultMaxRetries 默认的网络错误重试次数
+	DefaultMaxRetries = 2
+
+	// DefaultRetryBackoff 默认的重试间隔
+	DefaultRetryBackoff = 100 * time.Millisecond
+)
+
+// Error 服务器返回的错误信息
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Options 客户端配置, 值为0的字段使用默认值
+type Options struct {
+	// Addr 服务器地址
+	Addr string
+	// PoolSize 连接数量上限
+	PoolSize int
+	// DialTimeout 建立连接以及检查连接的超时时间
+	DialTimeout time.Duration
+	// IdleCheckInterval 连接空闲超过该时间后, 使用前发送ping检查是否可用
+	IdleCheckInterval time.Duration
+	// MaxRetries 网络错误时的重试次数, 小于0表示不重试
+	// 默认只在命令没有发送时重试, 例如建立连接或检查连接失败
+	MaxRetries int
+	// RetryAfterWrite 命令已经发送但没有收到回复时也重试, 非幂等的命令可能被执行多次
+	RetryAfterWrite bool
+	// RetryBackoff 重试间隔
+	RetryBackoff time.Duration
+}
+
+func (o *Options) init() {
+	if o.Addr == "" {
+		o.Addr = DefaultAddr
+	}
+	if o.PoolSize <= 0 {
+		o.PoolSize = DefaultPoolSize
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = DefaultDialTimeout
+	}
+	if o.IdleCheckInterval <= 0 {
+		o.IdleCheckInterval = DefaultIdleCheckInterval
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = DefaultMaxRetries
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = DefaultRetryBackoff
+	}
+}
+
+// Client 使用二进制协议访问服务器的客户端, 可以被多个协程同时使用
+type Client struct {
+	opts Options
+	pool *pool
+}
+
+// New 返回一个客户端, 连接在第一次使用时建立
+func New(opts Options) *Client {
+	opts.init()
+	return &Client{opts: opts, pool: newPool(&opts)}
+}
+
+// Close 关闭客户端和所有连接
+func (c *Client) Close() error {
+	return c.pool.close()
+}
+
+// Do 执行一条命令, 服务器返回的错误以Error类型返回
+func (c *Client) Do(ctx context.Context, args ...[]byte) (proto.Reply, error) {
+	replies, err := c.process(ctx, [][][]byte{args})
+	if err != nil {
+		return proto.Reply{}, err
+	}
+	if replies[0].Type == proto.ErrorReply {
+		return replies[0], Error(replies[0].Str)
+	}
+	return replies[0], nil
+}
+
+// Pipeline 返回一个流水线, 排队的命令在Exec时一起发送
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// 在一个连接上发送多条命令, 网络错误时换一个连接重试
+// 命令可能已经发送时, 只有设置了RetryAfterWrite才重试
+func (c *Client) process(ctx context.Context, cmds [][][]byte) ([]proto.Reply, error) {
+	var err error
+	for attempt := 0; attempt <= c.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(c.opts.RetryBackoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		var cn *conn
+		if cn, err = c.pool.get(ctx); err != nil {
+			if !retryable(ctx, err) {
+				return nil, err
+			}
+			continue
+		}
+
+		var replies []proto.Reply
+		replies, err = cn.roundTrip(ctx, cmds)
+		sent := cn.sent
+		c.pool.put(cn, err != nil)
+		if err == nil {
+			return replies, nil
+		}
+		if !retryable(ctx, err) || (sent && !c.opts.RetryAfterWrite) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// 判断是否可以重试, ctx结束和客户端关闭时不重试
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || err == ErrClosed {
+		return false
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, proto.ErrInvalidStatus) || isEOF(err)
+}
+
+// Pipeline 流水线, 多条命令只需要一次网络往返, 不能被多个协程同时使用
+type Pipeline struct {
+	c    *Client
+	cmds [][][]byte
+}
+
+// Do 将命令加入队列
+func (p *Pipeline) Do(args ...[]byte) {
+	p.cmds = append(p.cmds, args)
+}
+
+// Len 返回排队的命令数量
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Exec 发送所有排队的命令并按顺序返回回复, 之后清空队列
+// 单条命令的错误以ErrorReply类型的回复返回, 不影响其他命令
+// 网络错误时与Do一样只在命令没有发送时重试, 设置了RetryAfterWrite时整批命令都会重新发送
+func (p *Pipeline) Exec(ctx context.Context) ([]proto.Reply, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	return p.c.process(ctx, cmds)
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"kvstore/proto"
+	"strconv"
+	"time"
+)
+
+// NoTTL 键存在但没有过期时间
+const NoTTL time.Duration = -1
+
+// SetOptions 设置字符串时的可选参数
+type SetOptions struct {
+	// TTL 存活时间, 精确到毫秒, 为0表示不设置过期时间
+	TTL time.Duration
+	// NX 只在键不存在时设置
+	NX bool
+	// XX 只在键已经存在时设置
+	XX bool
+	// KeepTTL 保留键原来的过期时间
+	KeepTTL bool
+}
+
+// Ping 检查服务器是否可用
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, []byte("ping"))
+	return err
+}
+
+// Set 设置字符串
+func (c *Client) Set(ctx context.Context, key, value []byte) error {
+	_, err := c.Do(ctx, []byte("set"), key, value)
+	return err
+}
+
+// SetWithOptions 根据可选参数设置字符串, NX或XX的条件不满足时不设置并返回false
+func (c *Client) SetWithOptions(ctx context.Context, key, value []byte, opts SetOptions) (bool, error) {
+	args := [][]byte{[]byte("set"), key, value}
+	if opts.TTL > 0 {
+		args = append(args, []byte("px"), formatMs(opts.TTL))
+	}
+	if opts.KeepTTL {
+		args = append(args, []byte("keepttl"))
+	}
+	if opts.NX {
+		args = append(args, []byte("nx"))
+	}
+	if opts.XX {
+		args = append(args, []byte("xx"))
+	}
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return false, err
+	}
+	return reply.Type != proto.NilReply, nil
+}
+
+// Get 获取字符串, 键不存在时返回ErrNil
+func (c *Client) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return bytesReply(c.Do(ctx, []byte("get"), key))
+}
+
+// Del 删除字符串键, 返回被删除的键数量
+func (c *Client) Del(ctx context.Context, keys ...[]byte) (int, error) {
+	return intReply(c.Do(ctx, append([][]byte{[]byte("del")}, keys...)...))
+}
+
+// Expire 设置存活时间, 精确到毫秒, 键不存在时返回false
+func (c *Client) Expire(ctx context.Context, key []byte, ttl time.Duration) (bool, error) {
+	return boolReply(c.Do(ctx, []byte("pexpire"), key, formatMs(ttl)))
+}
+
+// ExpireAt 设置过期时间, 精确到毫秒, 键不存在时返回false
+func (c *Client) ExpireAt(ctx context.Context, key []byte, t time.Time) (bool, error) {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	return boolReply(c.Do(ctx, []byte("pexpireat"), key, []byte(strconv.FormatInt(ms, 10))))
+}
+
+// TTL 获得剩余存活时间, 键没有过期时间时返回NoTTL, 键不存在时返回ErrNil
+func (c *Client) TTL(ctx context.Context, key []byte) (time.Duration, error) {
+	ms, err := intReply(c.Do(ctx, []byte("pttl"), key))
+	switch {
+	case err != nil:
+		return 0, err
+	case ms == -2:
+		return 0, ErrNil
+	case ms == -1:
+		return NoTTL, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Persist 删除过期时间, 键不存在或没有过期时间时返回false
+func (c *Client) Persist(ctx context.Context, key []byte) (bool, error) {
+	return boolReply(c.Do(ctx, []byte("persist"), key))
+}
+
+// HSet 设置哈希表的字段
+func (c *Client) HSet(ctx context.Context, key, field, value []byte) (int, error) {
+	return intReply(c.Do(ctx, []byte("hset"), key, field, value))
+}
+
+// HGet 获取哈希表的字段, 字段不存在时返回ErrNil
+func (c *Client) HGet(ctx context.Context, key, field []byte) ([]byte, error) {
+	return bytesReply(c.Do(ctx, []byte("hget"), key, field))
+}
+
+// HDel 删除哈希表的字段, 返回被删除的字段数量
+func (c *Client) HDel(ctx context.Context, key []byte, fields ...[]byte) (int, error) {
+	return intReply(c.Do(ctx, append([][]byte{[]byte("hdel"), key}, fields...)...))
+}
+
+// HGetAll 获取哈希表的所有字段
+func (c *Client) HGetAll(ctx context.Context, key []byte) (map[string][]byte, error) {
+	values, err := bytesSliceReply(c.Do(ctx, []byte("hgetall"), key))
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]byte, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		res[string(values[i])] = values[i+1]
+	}
+	return res, nil
+}
+
+// LPush 从列表头部插入元素, 返回列表长度
+func (c *Client) LPush(ctx context.Context, key []byte, values ...[]byte) (int, error) {
+	return intReply(c.Do(ctx, append([][]byte{[]byte("lpush"), key}, values...)...))
+}
+
+// RPush 从列表尾部插入元素, 返回列表长度
+func (c *Client) RPush(ctx context.Context, key []byte, values ...[]byte) (int, error) {
+	return intReply(c.Do(ctx, append([][]byte{[]byte("rpush"), key}, values...)...))
+}
+
+// LPop 弹出列表头部的元素, 列表为空时返回ErrNil
+func (c *Client) LPop(ctx context.Context, key []byte) ([]byte, error) {
+	return bytesReply(c.Do(ctx, []byte("lpop"), key))
+}
+
+// RPop 弹出列表尾部的元素, 列表为空时返回ErrNil
+func (c *Client) RPop(ctx context.Context, key []byte) ([]byte, error) {
+	return bytesReply(c.Do(ctx, []byte("rpop"), key))
+}
+
+// LRange 获取列表区间内的元素
+func (c *Client) LRange(ctx context.Context, key []byte, start, stop int) ([][]byte, error) {
+	return bytesSliceReply(c.Do(ctx, []byte("lrange"), key, formatInt(start), formatInt(stop)))
+}
+
+// SAdd 向集合添加成员, 返回新添加的成员数量
+func (c *Client) SAdd(ctx context.Context, key []byte, members ...[]byte) (int, error) {
+	return intReply(c.Do(ctx, append([][]byte{[]byte("sadd"), key}, members...)...))
+}
+
+// SRem 删除集合的成员, 返回被删除的成员数量
+func (c *Client) SRem(ctx context.Context, key []byte, members ...[]byte) (int, error) {
+	return intReply(c.Do(ctx, append([][]byte{[]byte("srem"), key}, members...)...))
+}
+
+// SIsMember 判断是否为集合的成员
+func (c *Client) SIsMember(ctx context.Context, key, member []byte) (bool, error) {
+	return boolReply(c.Do(ctx, []byte("sismember"), key, member))
+}
+
+// SMembers 获取集合的所有成员
+func (c *Client) SMembers(ctx context.Context, key []byte) ([][]byte, error) {
+	return bytesSliceReply(c.Do(ctx, []byte("smembers"), key))
+}
+
+// ZAdd 向有序集合添加成员
+func (c *Client) ZAdd(ctx context.Context, key []byte, score float64, member []byte) (int, error) {
+	s := strconv.FormatFloat(score, 'g', -1, 64)
+	return intReply(c.Do(ctx, []byte("zadd"), key, []byte(s), member))
+}
+
+// ZScore 获取有序集合成员的分数, 成员不存在时返回ErrNil
+func (c *Client) ZScore(ctx context.Context, key, member []byte) (float64, error) {
+	data, err := bytesReply(c.Do(ctx, []byte("zscore"), key, member))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(data), 64)
+}
+
+// ZRange 获取有序集合区间内的成员
+func (c *Client) ZRange(ctx context.Context, key []byte, start, stop int) ([][]byte, error) {
+	return bytesSliceReply(c.Do(ctx, []byte("zrange"), key, formatInt(start), formatInt(stop)))
+}
+
+// 单个值的回复, 空值返回ErrNil
+func bytesReply(r proto.Reply, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch r.Type {
+	case proto.NilReply:
+		return nil, ErrNil
+	case proto.BulkReply, proto.StatusReply:
+		return []byte(r.Str), nil
+	}
+	return nil, ErrUnexpectedReply
+}
+
+// 整数回复
+func intReply(r proto.Reply, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	if r.Type != proto.IntegerReply {
+		return 0, ErrUnexpectedReply
+	}
+	return int(r.Int), nil
+}
+
+// 以0和1表示的布尔值回复
+func boolReply(r proto.Reply, err error) (bool, error) {
+	n, err := intReply(r, err)
+	return n == 1, err
+}
+
+// 多个值的回复
+func bytesSliceReply(r proto.Reply, err error) ([][]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if r.Type != proto.ArrayReply {
+		return nil, ErrUnexpectedReply
+	}
+	res := make([][]byte, 0, len(r.Elems))
+	for _, e := range r.Elems {
+		res = append(res, []byte(e.Str))
+	}
+	return res, nil
+}
+
+func formatInt(n int) []byte {
+	return []byte(strconv.Itoa(n))
+}
+
+func formatMs(d time.Duration) []byte {
+	return []byte(strconv.FormatInt(int64(d/time.Millisecond), 10))
+}
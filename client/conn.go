@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"kvstore/proto"
+	"net"
+	"time"
+)
+
+// 用于立即中断连接上阻塞的读写
+var aLongTimeAgo = time.Unix(1, 0)
+
+// 到服务器的一个连接
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+	// 最后一次使用的时间, 空闲过久的连接在使用前需要检查
+	usedAt time.Time
+	// 本次往返是否已经向连接写入数据, 写入之后失败时服务器可能已经执行了命令
+	sent bool
+}
+
+// 建立连接
+func dial(ctx context.Context, opts *Options) (*conn, error) {
+	d := net.Dialer{Timeout: opts.DialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{
+		nc:     nc,
+		r:      bufio.NewReader(nc),
+		usedAt: time.Now(),
+	}
+	cn.w = bufio.NewWriter(cn)
+	return cn, nil
+}
+
+// 写入连接, 同时记录已经写入过数据
+func (cn *conn) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		cn.sent = true
+	}
+	return cn.nc.Write(p)
+}
+
+// 依次发送多条命令, 再按顺序读取回复
+// 返回错误时连接的状态未知, 不能再使用
+func (cn *conn) roundTrip(ctx context.Context, cmds [][][]byte) ([]proto.Reply, error) {
+	stop := cn.watch(ctx)
+	defer stop()
+	cn.sent = false
+
+	for _, args := range cmds {
+		if err := proto.WriteCommand(cn.w, args...); err != nil {
+			return nil, ctxErr(ctx, err)
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	replies := make([]proto.Reply, 0, len(cmds))
+	for range cmds {
+		reply, err := proto.ReadReply(cn.r)
+		if err != nil {
+			return nil, ctxErr(ctx, err)
+		}
+		replies = append(replies, reply)
+	}
+	cn.usedAt = time.Now()
+	return replies, nil
+}
+
+// 根据ctx设置连接的读写期限, ctx取消时中断阻塞的读写, 返回的函数用于停止监听
+func (cn *conn) watch(ctx context.Context) func() {
+	deadline, _ := ctx.Deadline()
+	_ = cn.nc.SetDeadline(deadline)
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = cn.nc.SetDeadline(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (cn *conn) Close() error {
+	return cn.nc.Close()
+}
+
+// ctx结束导致的读写错误返回ctx的错误
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// 服务器关闭了连接
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
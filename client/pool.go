@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"kvstore/proto"
+	"sync"
+	"time"
+)
+
+// 连接池, slots中的每个元素代表一个可用的名额, 为空表示还没有建立连接
+type pool struct {
+	opts  *Options
+	slots chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newPool(opts *Options) *pool {
+	p := &pool{opts: opts, slots: make(chan *conn, opts.PoolSize)}
+	for i := 0; i < opts.PoolSize; i++ {
+		p.slots <- nil
+	}
+	return p
+}
+
+// 取出一个连接, 连接数量达到上限时等待其他调用归还
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	if p.isClosed() {
+		return nil, ErrClosed
+	}
+
+	var cn *conn
+	select {
+	case cn = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// 空闲过久的连接可能已经被服务器或网络设备关闭, 使用前先检查
+	if cn != nil && time.Since(cn.usedAt) > p.opts.IdleCheckInterval && !p.healthy(ctx, cn) {
+		_ = cn.Close()
+		cn = nil
+	}
+	if cn == nil {
+		var err error
+		if cn, err = dial(ctx, p.opts); err != nil {
+			p.slots <- nil
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// 归还连接, bad为true时关闭连接, 之后需要时重新建立
+func (p *pool) put(cn *conn, bad bool) {
+	if bad || p.isClosed() {
+		_ = cn.Close()
+		cn = nil
+	}
+	p.slots <- cn
+}
+
+// 发送ping检查连接是否可用
+func (p *pool) healthy(ctx context.Context, cn *conn) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.DialTimeout)
+	defer cancel()
+	replies, err := cn.roundTrip(ctx, [][][]byte{{[]byte("ping")}})
+	return err == nil && replies[0].Type == proto.StatusReply
+}
+
+func (p *pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// 关闭空闲的连接, 正在使用的连接在归还时关闭
+func (p *pool) close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	var err error
+	for i := len(p.slots); i > 0; i-- {
+		select {
+		case cn := <-p.slots:
+			if cn != nil {
+				if e := cn.Close(); e != nil && err == nil {
+					err = e
+				}
+			}
+			p.slots <- nil
+		default:
+			return err
+		}
+	}
+	return err
+}
@@ -2,37 +2,109 @@ package main
 
 import (
 	"bufio"
-	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/peterh/liner"
+	"kvstore/proto"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 var host = flag.String("p", "127.0.0.1", "input host to connect, default 127.0.0.1")
 var port = flag.String("h", "5000", "input port to connect, default 5000")
 
+var pipe = flag.Bool("pipe", false, "read commands from stdin line by line and send them in pipeline mode")
+
+var errUnbalancedQuotes = errors.New("Invalid argument(s): unbalanced quotes")
+
 var (
 	commandLists = [][]string{
-		{"set", "key value", "string"},
+		{"set", "key value [ex seconds|px milliseconds|keepttl] [nx|xx]", "string"},
 		{"get", "key", "string"},
-		{"expire", "key value", "string"},
+		{"del", "key [key...]", "string"},
+		{"expire", "key seconds", "string"},
+		{"pexpire", "key milliseconds", "string"},
+		{"expireat", "key timestamp", "string"},
+		{"pexpireat", "key milliseconds-timestamp", "string"},
+		{"ttl", "key", "string"},
+		{"pttl", "key", "string"},
+		{"persist", "key", "string"},
+		{"hset", "key field value", "hash"},
+		{"hget", "key field", "hash"},
+		{"hdel", "key field [field...]", "hash"},
+		{"hgetall", "key", "hash"},
+		{"hlen", "key", "hash"},
+		{"hexists", "key field", "hash"},
+		{"lpush", "key value [value...]", "list"},
+		{"rpush", "key value [value...]", "list"},
+		{"lpop", "key", "list"},
+		{"rpop", "key", "list"},
+		{"lindex", "key index", "list"},
+		{"lset", "key index value", "list"},
+		{"llen", "key", "list"},
+		{"lrem", "key count value", "list"},
+		{"ltrim", "key start end", "list"},
+		{"lrange", "key start end", "list"},
+		{"sadd", "key member [member...]", "set"},
+		{"srem", "key member [member...]", "set"},
+		{"smembers", "key", "set"},
+		{"sismember", "key member", "set"},
+		{"scard", "key", "set"},
+		{"spop", "key [count]", "set"},
+		{"srandmember", "key [count]", "set"},
+		{"sunion", "key [key...]", "set"},
+		{"sinter", "key [key...]", "set"},
+		{"sdiff", "key [key...]", "set"},
+		{"zadd", "key score member [score member...]", "zset"},
+		{"zscore", "key member", "zset"},
+		{"zincrby", "key increment member", "zset"},
+		{"zrem", "key member [member...]", "zset"},
+		{"zcard", "key", "zset"},
+		{"zrank", "key member", "zset"},
+		{"zrange", "key start stop", "zset"},
+		{"zrangebyscore", "key min max", "zset"},
+		{"keys", "pattern", "key"},
+		{"scan", "cursor [match pattern] [count n]", "key"},
+		{"range", "start end [count n]", "key"},
+		{"multi", "", "transaction"},
+		{"exec", "", "transaction"},
+		{"discard", "", "transaction"},
+		{"watch", "key [key...]", "transaction"},
+		{"unwatch", "", "transaction"},
+		{"ping", "[message]", "connection"},
+		{"echo", "message", "connection"},
+		{"merge", "[status]", "server"},
+		{"info", "", "server"},
 	}
 	historyFn = filepath.Join(os.TempDir(), ".liner_example_history")
 )
 
 
 func main() {
-	addr := fmt.Sprintf("%s:%s", *host, *port)
+	flag.Parse()
+	addr := net.JoinHostPort(*host, *port)
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
 		log.Printf("connect kvstore failed : %s\n", err.Error())
+		return
 	}
 	defer conn.Close()
+	connReader := bufio.NewReader(conn)
+	connWriter := bufio.NewWriter(conn)
+
+	// 流水线模式, 从标准输入读取命令
+	if *pipe {
+		if err := runPipe(conn, os.Stdin, os.Stdout); err != nil {
+			log.Printf("pipe failed : %s\n", err.Error())
+		}
+		return
+	}
 
 	line := liner.NewLiner()
 	defer line.Close()
@@ -74,17 +146,21 @@ func main() {
 			continue
 		}
 
-		// 全部转化为小写字符
-		cmd = strings.ToLower(cmd)
-
-		// 按空白符号分割字符串， 得到命令及命令所需要的数据
-		cmdAndArgs := strings.Split(cmd, " ")
+		// 按空白符号分割字符串， 得到命令及命令所需要的数据, 引号内的内容作为一个参数
+		cmdAndArgs, err := splitArgs(cmd)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		// 命令名转化为小写字符
+		cmdAndArgs[0] = strings.ToLower(cmdAndArgs[0])
 
-		if cmd == "quit" {
+		if cmdAndArgs[0] == "quit" {
 			break
-		} else if cmd == "help" {
+		} else if len(cmdAndArgs) == 1 && cmdAndArgs[0] == "help" {
 			printCmdHelp()
 		} else if len(cmdAndArgs) == 2 && cmdAndArgs[0] == "help" {
+			cmdAndArgs[1] = strings.ToLower(cmdAndArgs[1])
 			if !commandSet[cmdAndArgs[1]] {
 				fmt.Printf("command not found\n")
 				continue
@@ -106,13 +182,20 @@ func main() {
 			}
 
 			// 封装命令， 传递给服务端
-			_, err := conn.Write(wrapCmd(cmd))
+			if err := proto.WriteCommand(connWriter, toBytes(cmdAndArgs)...); err == nil {
+				err = connWriter.Flush()
+			}
 			if err != nil {
 				fmt.Println(err)
+				break
 			}
 			// 接受服务端返回的数据
-			reply := readReply(conn)
-			fmt.Println(reply)
+			reply, err := proto.ReadReply(connReader)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			fmt.Println(formatReply(reply, ""))
 		}
 	}
 
@@ -125,29 +208,112 @@ func main() {
 	}
 }
 
-func wrapCmd(args string) []byte {
-	data := make([]byte, len(args)+4)
-	binary.BigEndian.PutUint32(data[:4], uint32(len(args)))
-	copy(data[4:], args)
-	return data
+// 分割命令行参数, 双引号内支持\n, \t, \", \\和\xhh转义, 单引号内只支持\'转义
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	for i := 0; i < len(line); {
+		// 跳过空白字符
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		var arg []byte
+		var quote byte
+		if line[i] == '"' || line[i] == '\'' {
+			quote = line[i]
+			i++
+		}
+		for ; ; i++ {
+			if i == len(line) {
+				if quote != 0 {
+					return nil, errUnbalancedQuotes
+				}
+				break
+			}
+			c := line[i]
+			if quote == 0 {
+				if c == ' ' || c == '\t' {
+					break
+				}
+				arg = append(arg, c)
+				continue
+			}
+			if c == quote {
+				// 引号之后必须是空白字符
+				i++
+				if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+					return nil, errUnbalancedQuotes
+				}
+				break
+			}
+			if c == '\\' && i+1 < len(line) {
+				if quote == '\'' {
+					if line[i+1] == '\'' {
+						i++
+						c = '\''
+					}
+				} else if b, n := unescape(line[i+1:]); n > 0 {
+					i += n
+					c = b
+				}
+			}
+			arg = append(arg, c)
+		}
+		args = append(args, string(arg))
+	}
+	return args, nil
 }
 
-func readReply(conn net.Conn) (res string) {
-	bufReader := bufio.NewReader(conn)
-	buf := make([]byte, 4)
-	_, err := bufReader.Read(buf)
-	if err != nil {
-		return
+// 解析双引号内反斜杠之后的转义字符, 返回转义结果和占用的字符数
+func unescape(s string) (byte, int) {
+	switch s[0] {
+	case 'n':
+		return '\n', 1
+	case 'r':
+		return '\r', 1
+	case 't':
+		return '\t', 1
+	case '"', '\\':
+		return s[0], 1
+	case 'x':
+		if len(s) >= 3 {
+			if b, err := hex.DecodeString(s[1:3]); err == nil {
+				return b[0], 3
+			}
+		}
 	}
-	size := binary.BigEndian.Uint32(buf)
-	if size > 0 {
-		data := make([]byte, size)
-		_, err = bufReader.Read(data)
-		if err == nil {
-			res = string(data)
+	return 0, 0
+}
+
+// 按照回复的类型格式化输出, 数组的元素带有序号
+func formatReply(r proto.Reply, indent string) string {
+	switch r.Type {
+	case proto.StatusReply:
+		return r.Str
+	case proto.ErrorReply:
+		return "(error) " + r.Str
+	case proto.IntegerReply:
+		return fmt.Sprintf("(integer) %d", r.Int)
+	case proto.NilReply:
+		return "(nil)"
+	case proto.ArrayReply:
+		if len(r.Elems) == 0 {
+			return "(empty array)"
+		}
+		lines := make([]string, 0, len(r.Elems))
+		for i, e := range r.Elems {
+			// 第一个元素紧跟在上一级的序号之后, 不需要缩进
+			prefix := fmt.Sprintf("%d) ", i+1)
+			sub := formatReply(e, indent+strings.Repeat(" ", len(prefix)))
+			if i > 0 {
+				prefix = indent + prefix
+			}
+			lines = append(lines, prefix+sub)
 		}
+		return strings.Join(lines, "\n")
 	}
-	return
+	return strconv.Quote(r.Str)
 }
 
 func printCmdHelp() {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"kvstore/proto"
+	"net"
+	"strings"
+)
+
+// 流水线模式: 逐行读取命令并连续发送, 不等待回复, 同时在另一个协程中读取回复
+// 所有命令发送完后再发送一条带有随机内容的echo命令, 读到它的回复说明之前的命令都已经执行完毕
+func runPipe(conn net.Conn, in io.Reader, out io.Writer) error {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	marker := hex.EncodeToString(buf)
+
+	// 发送命令
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- sendPipe(conn, in, out, marker)
+	}()
+
+	// 读取回复, 只输出错误信息
+	r := bufio.NewReader(conn)
+	replies, errs := 0, 0
+	for {
+		reply, err := proto.ReadReply(r)
+		if err != nil {
+			// 发送失败时连接已经关闭, 返回发送时的错误
+			select {
+			case e := <-sendErr:
+				if e != nil {
+					return e
+				}
+			default:
+			}
+			return err
+		}
+		if reply.Type == proto.BulkReply && reply.Str == marker {
+			break
+		}
+		replies++
+		if reply.Type == proto.ErrorReply {
+			errs++
+			fmt.Fprintf(out, "(error) %s\n", reply.Str)
+		}
+	}
+	if err := <-sendErr; err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "errors: %d, replies: %d\n", errs, replies)
+	return nil
+}
+
+// 逐行发送命令, 最后发送echo命令作为结束标记
+func sendPipe(conn net.Conn, in io.Reader, out io.Writer, marker string) error {
+	r := bufio.NewReader(in)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			args, perr := splitArgs(line)
+			if perr != nil {
+				fmt.Fprintf(out, "skip %q : %s\n", line, perr.Error())
+			} else if werr := proto.WriteCommand(w, toBytes(args)...); werr != nil {
+				conn.Close()
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if err := proto.WriteCommand(w, []byte("echo"), []byte(marker)); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// 字符串参数转化为字节切片
+func toBytes(args []string) [][]byte {
+	res := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		res = append(res, []byte(arg))
+	}
+	return res
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"kvstore"
+	"kvstore/proto"
+)
+
+// ping [message], 没有参数时返回PONG
+func ping(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) > 1 {
+		err = ErrSyntax
+		return
+	}
+	res = statusReply("PONG")
+	if len(args) == 1 {
+		res = bulkReply([]byte(args[0]))
+	}
+	return
+}
+
+func echo(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	res = bulkReply([]byte(args[0]))
+	return
+}
+
+// command, redis客户端连接时会查询命令信息, 这里只返回空数组
+func command(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	res = Reply{Type: proto.ArrayReply}
+	return
+}
+
+func init() {
+	addCmdHandle("ping", ping)
+	addCmdHandle("echo", echo)
+	addCmdHandle("command", command)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"kvstore"
+	"log"
+	"strings"
+	"time"
+)
+
+// merge [status], 在后台合并归档文件, status查看合并进度
+func merge(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) > 1 || (len(args) == 1 && strings.ToLower(args[0]) != "status") {
+		err = ErrSyntax
+		return
+	}
+
+	// 没有正在执行的合并时启动合并
+	if len(args) == 0 && !kv.MergeProgress().Running {
+		go func() {
+			if err := kv.Merge(); err != nil && err != kvstore.ErrMergeInProgress {
+				log.Printf("merge failed : %s\n", err.Error())
+			}
+		}()
+		res = statusReply("merge started")
+		return
+	}
+	res = bulkReply([]byte(formatProgress(kv.MergeProgress())))
+	return
+}
+
+// 格式化合并进度
+func formatProgress(p kvstore.MergeProgress) string {
+	if p.StartTime.IsZero() {
+		return "no merge has been run"
+	}
+
+	lines := []string{
+		fmt.Sprintf("running:%t", p.Running),
+		fmt.Sprintf("files:%d/%d", p.Merged, p.Files),
+		fmt.Sprintf("reclaimed_bytes:%d", p.Reclaimed),
+	}
+	if p.Running {
+		lines = append(lines, fmt.Sprintf("current_file:%06d", p.Current))
+		lines = append(lines, fmt.Sprintf("elapsed:%s", time.Since(p.StartTime).Round(time.Millisecond)))
+	} else {
+		lines = append(lines, fmt.Sprintf("elapsed:%s", p.EndTime.Sub(p.StartTime).Round(time.Millisecond)))
+	}
+	if p.Err != nil {
+		lines = append(lines, "error:"+p.Err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// info, 返回各数据文件的大小和失效数据比例, 以及主动过期, 值缓存和内存淘汰的统计信息
+func info(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 0 {
+		err = ErrSyntax
+		return
+	}
+
+	stats := kv.Stats()
+	lines := []string{
+		fmt.Sprintf("data_files:%d", len(stats.DataFiles)),
+		fmt.Sprintf("size_bytes:%d", stats.Size),
+		fmt.Sprintf("garbage_bytes:%d", stats.Garbage),
+	}
+	for _, f := range stats.DataFiles {
+		line := fmt.Sprintf("file_%06d:size=%d,garbage=%d,ratio=%.2f", f.Id, f.Size, f.Garbage, f.GarbageRatio())
+		if f.Active {
+			line += ",active"
+		}
+		lines = append(lines, line)
+	}
+
+	// 主动过期的统计信息
+	es := kv.ExpireStats()
+	lines = append(lines,
+		fmt.Sprintf("expire_cycles:%d", es.Cycles),
+		fmt.Sprintf("expire_sampled_keys:%d", es.Sampled),
+		fmt.Sprintf("expired_keys:%d", es.Expired),
+		fmt.Sprintf("expire_time_limit_hits:%d", es.TimeLimitHits),
+		fmt.Sprintf("expire_last_ratio:%.2f", es.LastExpiredRatio),
+		fmt.Sprintf("expire_last_duration:%s", es.LastDuration),
+	)
+
+	// 值缓存的统计信息
+	cs := kv.CacheStats()
+	lines = append(lines,
+		fmt.Sprintf("value_cache_hits:%d", cs.Hits),
+		fmt.Sprintf("value_cache_misses:%d", cs.Misses),
+		fmt.Sprintf("value_cache_hit_ratio:%.2f", cs.HitRatio()),
+		fmt.Sprintf("value_cache_evictions:%d", cs.Evictions),
+		fmt.Sprintf("value_cache_rejections:%d", cs.Rejections),
+		fmt.Sprintf("value_cache_items:%d", cs.Items),
+		fmt.Sprintf("value_cache_bytes:%d/%d", cs.Size, cs.Capacity),
+	)
+
+	// 内存上限和淘汰的统计信息
+	ms := kv.MemoryStats()
+	lines = append(lines,
+		fmt.Sprintf("used_memory:%d", ms.Used),
+		fmt.Sprintf("max_memory:%d", ms.MaxMemory),
+		fmt.Sprintf("eviction_policy:%s", ms.Policy),
+		fmt.Sprintf("evicted_keys:%d", ms.Evicted),
+		fmt.Sprintf("rejected_writes:%d", ms.Rejected),
+	)
+	res = bulkReply([]byte(strings.Join(lines, "\n")))
+	return
+}
+
+func init() {
+	addCmdHandle("merge", merge)
+	addCmdHandle("info", info)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"kvstore"
+)
+
+func hset(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	var count int
+	if count, err = kv.HSet([]byte(args[0]), []byte(args[1]), []byte(args[2])); err == nil {
+		res = intReply(count)
+	}
+	return
+}
+
+func hget(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 2 {
+		err = ErrSyntax
+		return
+	}
+	res, err = bulkOrNil(kv.HGet([]byte(args[0]), []byte(args[1])))
+	return
+}
+
+func hdel(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 2 {
+		err = ErrSyntax
+		return
+	}
+	var count int
+	if count, err = kv.HDel([]byte(args[0]), toBytes(args[1:])...); err == nil {
+		res = intReply(count)
+	}
+	return
+}
+
+func hgetall(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	var data [][]byte
+	if data, err = kv.HGetAll([]byte(args[0])); err == nil {
+		res = mapReply(data)
+	}
+	return
+}
+
+func hlen(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	res = intReply(kv.HLen([]byte(args[0])))
+	return
+}
+
+func hexists(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 2 {
+		err = ErrSyntax
+		return
+	}
+	res = boolReply(kv.HExists([]byte(args[0]), []byte(args[1])))
+	return
+}
+
+func init() {
+	addCmdHandle("hset", hset)
+	addCmdHandle("hget", hget)
+	addCmdHandle("hdel", hdel)
+	addCmdHandle("hgetall", hgetall)
+	addCmdHandle("hlen", hlen)
+	addCmdHandle("hexists", hexists)
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"kvstore"
+	"kvstore/proto"
+	"strconv"
+	"strings"
+)
+
+// 默认每次扫描返回的键数量
+const defaultScanCount = 10
+
+func keys(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+
+	it := kv.NewIterator(kvstore.IteratorOptions{Prefix: patternPrefix(args[0])})
+	defer it.Close()
+
+	var data [][]byte
+	for ; it.Valid(); it.Next() {
+		if stringMatch(args[0], string(it.Key())) {
+			data = append(data, append([]byte{}, it.Key()...))
+		}
+	}
+	res = bulksReply(data)
+	return
+}
+
+// scan cursor [match pattern] [count n], 游标为下一次扫描起始键的十六进制编码, 0表示扫描开始或结束
+func scan(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 1 || len(args)%2 != 1 {
+		err = ErrSyntax
+		return
+	}
+	var start []byte
+	if args[0] != "0" {
+		if start, err = hex.DecodeString(args[0]); err != nil {
+			err = ErrSyntax
+			return
+		}
+	}
+	pattern, count := "*", defaultScanCount
+	for i := 1; i < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				err = ErrSyntax
+				return
+			}
+		default:
+			err = ErrSyntax
+			return
+		}
+	}
+
+	it := kv.NewIterator(kvstore.IteratorOptions{Prefix: patternPrefix(pattern)})
+	defer it.Close()
+	it.Seek(start)
+
+	// 每次最多检查count个键, 与redis一样返回的键可能少于count个
+	var data [][]byte
+	for i := 0; i < count && it.Valid(); i++ {
+		if stringMatch(pattern, string(it.Key())) {
+			data = append(data, append([]byte{}, it.Key()...))
+		}
+		it.Next()
+	}
+
+	// 与redis一样返回游标和键组成的数组
+	cursor := "0"
+	if it.Valid() {
+		cursor = hex.EncodeToString(it.Key())
+	}
+	res = Reply{Type: proto.ArrayReply, Elems: []Reply{bulkReply([]byte(cursor)), bulksReply(data)}}
+	return
+}
+
+// range start end [count n], 返回区间[start, end)内的键值对, start为-表示没有下界, end为+表示没有上界
+func rangeKeys(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 2 && len(args) != 4 {
+		err = ErrSyntax
+		return
+	}
+	count := -1
+	if len(args) == 4 {
+		if strings.ToLower(args[2]) != "count" {
+			err = ErrSyntax
+			return
+		}
+		if count, err = strconv.Atoi(args[3]); err != nil || count <= 0 {
+			err = ErrSyntax
+			return
+		}
+	}
+	var opts kvstore.IteratorOptions
+	if args[0] != "-" {
+		opts.Start = []byte(args[0])
+	}
+	if args[1] != "+" {
+		opts.End = []byte(args[1])
+	}
+
+	it := kv.NewIterator(opts)
+	defer it.Close()
+
+	var data [][]byte
+	for ; it.Valid() && count != 0; it.Next() {
+		data = append(data, append([]byte{}, it.Key()...), it.Value())
+		count--
+	}
+	err = it.Err()
+	res = bulksReply(data)
+	return
+}
+
+// 返回匹配模式中通配符之前的前缀
+func patternPrefix(pattern string) []byte {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return []byte(pattern[:i])
+	}
+	return []byte(pattern)
+}
+
+func init() {
+	addCmdHandle("keys", keys)
+	addCmdHandle("scan", scan)
+	addCmdHandle("range", rangeKeys)
+}
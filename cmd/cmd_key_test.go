@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"kvstore"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStringMatch(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"user:*", "user:1/profile", true},
+		{"a*c", "a/b/c", true},
+		{"a?c", "a/c", true},
+		{"a?c", "ac", false},
+		{"a**", "a", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`[\]]`, "]", true},
+		// 未闭合的[与redis一样视为到模式结尾
+		{"a[bc", "ab", true},
+		{"a[", "a", false},
+		{"abc", "ab", false},
+		{"ab", "abc", false},
+	}
+	for _, tt := range tests {
+		if got := stringMatch(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("stringMatch(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestKeysMatchSlash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := kvstore.DefaultConfig()
+	config.DirPath = dir
+	kv, err := kvstore.Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	for _, key := range []string{"a/b", "a/b/c", "ab", "b/a"} {
+		if err := kv.Set([]byte(key), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := keys(kv, []string{"a*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bulksReply([][]byte{[]byte("a/b"), []byte("a/b/c"), []byte("ab")}); !reflect.DeepEqual(res, want) {
+		t.Fatalf("keys a*: got %+v, want %+v", res, want)
+	}
+	res, err = scan(kv, []string{"0", "match", "*/b*", "count", "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bulksReply([][]byte{[]byte("a/b"), []byte("a/b/c")}); !reflect.DeepEqual(res.Elems[1], want) {
+		t.Fatalf("scan */b*: got %+v, want %+v", res.Elems[1], want)
+	}
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"kvstore"
+	"strconv"
+)
+
+func lpush(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 2 {
+		err = ErrSyntax
+		return
+	}
+	var size int
+	if size, err = kv.LPush([]byte(args[0]), toBytes(args[1:])...); err == nil {
+		res = intReply(size)
+	}
+	return
+}
+
+func rpush(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 2 {
+		err = ErrSyntax
+		return
+	}
+	var size int
+	if size, err = kv.RPush([]byte(args[0]), toBytes(args[1:])...); err == nil {
+		res = intReply(size)
+	}
+	return
+}
+
+func lpop(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	res, err = bulkOrNil(kv.LPop([]byte(args[0])))
+	return
+}
+
+func rpop(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	res, err = bulkOrNil(kv.RPop([]byte(args[0])))
+	return
+}
+
+func lindex(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 2 {
+		err = ErrSyntax
+		return
+	}
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		err = ErrSyntax
+		return
+	}
+	res, err = bulkOrNil(kv.LIndex([]byte(args[0]), idx))
+	return
+}
+
+func lset(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		err = ErrSyntax
+		return
+	}
+	if err = kv.LSet([]byte(args[0]), idx, []byte(args[2])); err == nil {
+		res = okReply
+	}
+	return
+}
+
+func llen(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	res = intReply(kv.LLen([]byte(args[0])))
+	return
+}
+
+func lrem(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		err = ErrSyntax
+		return
+	}
+	var removed int
+	if removed, err = kv.LRem([]byte(args[0]), []byte(args[2]), count); err == nil {
+		res = intReply(removed)
+	}
+	return
+}
+
+func ltrim(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	start, end, err := parseRange(args[1], args[2])
+	if err != nil {
+		return
+	}
+	if err = kv.LTrim([]byte(args[0]), start, end); err == nil {
+		res = okReply
+	}
+	return
+}
+
+func lrange(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	start, end, err := parseRange(args[1], args[2])
+	if err != nil {
+		return
+	}
+	var data [][]byte
+	if data, err = kv.LRange([]byte(args[0]), start, end); err == nil {
+		res = bulksReply(data)
+	}
+	return
+}
+
+// 解析区间参数
+func parseRange(start, end string) (int, int, error) {
+	s, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, ErrSyntax
+	}
+	e, err := strconv.Atoi(end)
+	if err != nil {
+		return 0, 0, ErrSyntax
+	}
+	return s, e, nil
+}
+
+// 字符串参数转化为字节切片
+func toBytes(args []string) (res [][]byte) {
+	for _, arg := range args {
+		res = append(res, []byte(arg))
+	}
+	return
+}
+
+func init() {
+	addCmdHandle("lpush", lpush)
+	addCmdHandle("rpush", rpush)
+	addCmdHandle("lpop", lpop)
+	addCmdHandle("rpop", rpop)
+	addCmdHandle("lindex", lindex)
+	addCmdHandle("lset", lset)
+	addCmdHandle("llen", llen)
+	addCmdHandle("lrem", lrem)
+	addCmdHandle("ltrim", ltrim)
+	addCmdHandle("lrange", lrange)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"kvstore"
+	"strconv"
+)
+
+func sadd(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 2 {
+		err = ErrSyntax
+		return
+	}
+	var count int
+	if count, err = kv.SAdd([]byte(args[0]), toBytes(args[1:])...); err == nil {
+		res = intReply(count)
+	}
+	return
+}
+
+func srem(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 2 {
+		err = ErrSyntax
+		return
+	}
+	var count int
+	if count, err = kv.SRem([]byte(args[0]), toBytes(args[1:])...); err == nil {
+		res = intReply(count)
+	}
+	return
+}
+
+func smembers(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	var data [][]byte
+	if data, err = kv.SMembers([]byte(args[0])); err == nil {
+		res = bulksReply(data)
+	}
+	return
+}
+
+func sismember(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 2 {
+		err = ErrSyntax
+		return
+	}
+	res = boolReply(kv.SIsMember([]byte(args[0]), []byte(args[1])))
+	return
+}
+
+func scard(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	res = intReply(kv.SCard([]byte(args[0])))
+	return
+}
+
+func spop(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	count, err := parseCount(args)
+	if err != nil {
+		return
+	}
+	var data [][]byte
+	if data, err = kv.SPop([]byte(args[0]), count); err == nil {
+		res = bulksReply(data)
+	}
+	return
+}
+
+func srandmember(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	count, err := parseCount(args)
+	if err != nil {
+		return
+	}
+	var data [][]byte
+	if data, err = kv.SRandMember([]byte(args[0]), count); err == nil {
+		res = bulksReply(data)
+	}
+	return
+}
+
+func sunion(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	return setAlgebra(kv.SUnion, args)
+}
+
+func sinter(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	return setAlgebra(kv.SInter, args)
+}
+
+func sdiff(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	return setAlgebra(kv.SDiff, args)
+}
+
+// 集合运算命令统一处理
+func setAlgebra(op func(...[]byte) ([][]byte, error), args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 1 {
+		err = ErrSyntax
+		return
+	}
+	var data [][]byte
+	if data, err = op(toBytes(args)...); err == nil {
+		res = bulksReply(data)
+	}
+	return
+}
+
+// 解析 key [count] 形式的参数, count默认为1
+func parseCount(args []string) (int, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return 0, ErrSyntax
+	}
+	if len(args) == 1 {
+		return 1, nil
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, ErrSyntax
+	}
+	return count, nil
+}
+
+func init() {
+	addCmdHandle("sadd", sadd)
+	addCmdHandle("srem", srem)
+	addCmdHandle("smembers", smembers)
+	addCmdHandle("sismember", sismember)
+	addCmdHandle("scard", scard)
+	addCmdHandle("spop", spop)
+	addCmdHandle("srandmember", srandmember)
+	addCmdHandle("sunion", sunion)
+	addCmdHandle("sinter", sinter)
+	addCmdHandle("sdiff", sdiff)
+}
@@ -3,51 +3,194 @@ package cmd
 import (
 	"errors"
 	"kvstore"
+	"kvstore/proto"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var ErrSyntax = errors.New("invalid syntax")
-func set(kv *kvstore.Kvstore, args []string) (res string, err error) {
+// set key value [ex seconds|px milliseconds|keepttl] [nx|xx], 条件不满足没有设置时返回空值
+func set(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
 	//检查参数是否合格
-	if len(args) != 2 {
+	if len(args) < 2 {
 		err = ErrSyntax
 		return
 	}
-	if err = kv.Set([]byte(args[0]), []byte(args[1])); err == nil {
-		res = "ok"
+	if len(args) == 2 {
+		if err = kv.Set([]byte(args[0]), []byte(args[1])); err == nil {
+			res = okReply
+		}
+		return
+	}
+
+	var opts kvstore.SetOptions
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "ex", "px":
+			if opts.TTL != 0 || i+1 == len(args) {
+				err = ErrSyntax
+				return
+			}
+			var n uint64
+			if n, err = strconv.ParseUint(args[i+1], 10, 64); err != nil || n == 0 {
+				err = ErrSyntax
+				return
+			}
+			unit := time.Millisecond
+			if strings.ToLower(args[i]) == "ex" {
+				unit = time.Second
+			}
+			if n > uint64(math.MaxInt64/unit) {
+				err = kvstore.ErrInvalidExpireTime
+				return
+			}
+			opts.TTL = time.Duration(n) * unit
+			i++
+		case "nx":
+			opts.NX = true
+		case "xx":
+			opts.XX = true
+		case "keepttl":
+			opts.KeepTTL = true
+		default:
+			err = ErrSyntax
+			return
+		}
+	}
+
+	var ok bool
+	if ok, err = kv.SetWithOptions([]byte(args[0]), []byte(args[1]), opts); err != nil {
+		return
+	}
+	res = nilReply
+	if ok {
+		res = okReply
 	}
 	return
 }
 
-func get(kv *kvstore.Kvstore, args []string) (res string, err error) {
+func get(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
 	// 检查参数
 	if len(args) != 1 {
 		err = ErrSyntax
 		return
 	}
-	var data []byte
-	data, err = kv.Get([]byte(args[0]))
-	res = string(data)
+	res, err = bulkOrNil(kv.Get([]byte(args[0])))
+	return
+}
+
+// del key [key...], 删除字符串键, 返回被删除的键数量
+func del(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 1 {
+		err = ErrSyntax
+		return
+	}
+	count := 0
+	for _, key := range args {
+		var exist bool
+		if exist, err = kv.StrRemExist([]byte(key)); err != nil {
+			return
+		}
+		if exist {
+			count++
+		}
+	}
+	res, err = intReply(count), nil
 	return
 }
 
-func expire(kv *kvstore.Kvstore, args []string) (res string, err error) {
+func expire(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	return expireCmd(kv.Expire, args)
+}
+
+func pexpire(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	return expireCmd(kv.PExpire, args)
+}
+
+func expireat(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	return expireCmd(kv.ExpireAt, args)
+}
+
+func pexpireat(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	return expireCmd(kv.PExpireAt, args)
+}
+
+// 设置过期时间的命令, 参数为键和非负整数, 与redis一样设置成功返回1, 键不存在返回0
+func expireCmd(fn func([]byte, uint64) error, args []string) (res Reply, err error) {
 	if len(args) != 2 {
 		err = ErrSyntax
 		return
 	}
-	seconds, err := strconv.Atoi(args[1])
+	n, err := strconv.ParseUint(args[1], 10, 64)
 	if err != nil {
 		err = ErrSyntax
 		return
 	}
-	if err = kv.Expire([]byte(args[0]), uint64(seconds)); err == nil {
-		res = "OK"
+	switch err = fn([]byte(args[0]), n); err {
+	case nil:
+		res = intReply(1)
+	case kvstore.ErrKeyNotExist:
+		res, err = intReply(0), nil
 	}
 	return
 }
+
+func ttl(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	return ttlReply(kv.TTL([]byte(args[0])))
+}
+
+func pttl(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	return ttlReply(kv.PTTL([]byte(args[0])))
+}
+
+// 剩余存活时间, 与redis一样键不存在返回-2, 没有过期时间返回-1
+func ttlReply(remain uint64, err error) (Reply, error) {
+	switch err {
+	case nil:
+		return Reply{Type: proto.IntegerReply, Int: int64(remain)}, nil
+	case kvstore.ErrKeyNotExist, kvstore.ErrKeyHasExpired:
+		return intReply(-2), nil
+	case kvstore.ErrKeyIsPermanent:
+		return intReply(-1), nil
+	}
+	return Reply{}, err
+}
+
+func persist(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	// 删除了过期时间返回1, 键不存在或没有过期时间返回0
+	switch err = kv.Persist([]byte(args[0])); err {
+	case nil:
+		res = intReply(1)
+	case kvstore.ErrKeyNotExist, kvstore.ErrKeyIsPermanent:
+		res, err = intReply(0), nil
+	}
+	return
+}
+
 func init() {
 	addCmdHandle("set", set)
 	addCmdHandle("get", get)
+	addCmdHandle("del", del)
 	addCmdHandle("expire", expire)
+	addCmdHandle("pexpire", pexpire)
+	addCmdHandle("expireat", expireat)
+	addCmdHandle("pexpireat", pexpireat)
+	addCmdHandle("ttl", ttl)
+	addCmdHandle("pttl", pttl)
+	addCmdHandle("persist", persist)
 }
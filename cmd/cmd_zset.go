@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"kvstore"
+	"strconv"
+)
+
+func zadd(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数, 分数和成员成对出现
+	if len(args) < 3 || len(args)%2 != 1 {
+		err = ErrSyntax
+		return
+	}
+	count := 0
+	for i := 1; i < len(args); i += 2 {
+		var score float64
+		if score, err = strconv.ParseFloat(args[i], 64); err != nil {
+			err = ErrSyntax
+			return
+		}
+		var n int
+		if n, err = kv.ZAdd([]byte(args[0]), score, []byte(args[i+1])); err != nil {
+			return
+		}
+		count += n
+	}
+	res = intReply(count)
+	return
+}
+
+func zscore(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 2 {
+		err = ErrSyntax
+		return
+	}
+	res = nilReply
+	if score, exist := kv.ZScore([]byte(args[0]), []byte(args[1])); exist {
+		res = doubleReply(score)
+	}
+	return
+}
+
+func zincrby(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	increment, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		err = ErrSyntax
+		return
+	}
+	var score float64
+	if score, err = kv.ZIncrBy([]byte(args[0]), increment, []byte(args[2])); err == nil {
+		res = doubleReply(score)
+	}
+	return
+}
+
+func zrem(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) < 2 {
+		err = ErrSyntax
+		return
+	}
+	var count int
+	if count, err = kv.ZRem([]byte(args[0]), toBytes(args[1:])...); err == nil {
+		res = intReply(count)
+	}
+	return
+}
+
+func zcard(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 1 {
+		err = ErrSyntax
+		return
+	}
+	res = intReply(kv.ZCard([]byte(args[0])))
+	return
+}
+
+func zrank(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 2 {
+		err = ErrSyntax
+		return
+	}
+	res = nilReply
+	if rank, exist := kv.ZRank([]byte(args[0]), []byte(args[1])); exist {
+		res = intReply(rank)
+	}
+	return
+}
+
+func zrange(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	start, stop, err := parseRange(args[1], args[2])
+	if err != nil {
+		return
+	}
+	var data [][]byte
+	if data, err = kv.ZRange([]byte(args[0]), start, stop); err == nil {
+		res = bulksReply(data)
+	}
+	return
+}
+
+func zrangebyscore(kv *kvstore.Kvstore, args []string) (res Reply, err error) {
+	// 检查参数
+	if len(args) != 3 {
+		err = ErrSyntax
+		return
+	}
+	min, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		err = ErrSyntax
+		return
+	}
+	max, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		err = ErrSyntax
+		return
+	}
+	var data [][]byte
+	if data, err = kv.ZRangeByScore([]byte(args[0]), min, max); err == nil {
+		res = bulksReply(data)
+	}
+	return
+}
+
+func init() {
+	addCmdHandle("zadd", zadd)
+	addCmdHandle("zscore", zscore)
+	addCmdHandle("zincrby", zincrby)
+	addCmdHandle("zrem", zrem)
+	addCmdHandle("zcard", zcard)
+	addCmdHandle("zrank", zrank)
+	addCmdHandle("zrange", zrange)
+	addCmdHandle("zrangebyscore", zrangebyscore)
+}
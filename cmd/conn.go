@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"kvstore/proto"
+	"log"
+	"net"
+	"time"
+)
+
+// 每个连接最多预先读取的命令数量
+const pipelineSize = 1024
+
+// 连接使用的协议
+type codec interface {
+	// ReadCommand 读取一条命令, 第一个参数为命令名
+	ReadCommand() ([]string, error)
+	// WriteReply 将回复写入缓冲区
+	WriteReply(Reply) error
+	// Flush 发送缓冲区中的回复
+	Flush() error
+}
+
+// 二进制协议
+type nativeCodec struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *nativeCodec) ReadCommand() ([]string, error) {
+	args, err := proto.ReadCommand(c.r)
+	if err != nil {
+		return nil, err
+	}
+	return toStrings(args), nil
+}
+
+func (c *nativeCodec) WriteReply(r Reply) error {
+	return proto.WriteReply(c.w, r)
+}
+
+func (c *nativeCodec) Flush() error {
+	return c.w.Flush()
+}
+
+// 读取到的一条命令
+type request struct {
+	args []string
+	err  error
+}
+
+// 处理连接上的命令
+// 读取协程持续解码客户端发送的命令, 当前协程按顺序执行并将回复写入缓冲区,
+// 已经读取的命令全部执行完后才发送回复, 流水线中的多条命令只需要一次网络往返
+func (s *server) serve(conn net.Conn, c codec, ss *session) {
+	reqs := make(chan request, pipelineSize)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(reqs)
+		for {
+			// 设置过期时间
+			_ = conn.SetReadDeadline(time.Now().Add(time.Hour * connInterval))
+
+			args, err := c.ReadCommand()
+			select {
+			case reqs <- request{args: args, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for req := range reqs {
+		if req.err != nil {
+			// 协议错误时回复错误信息后关闭连接
+			if isProtocolError(req.err) {
+				_ = c.WriteReply(errorReply(req.err))
+				_ = c.Flush()
+			} else if req.err != io.EOF {
+				log.Printf("read cmd err : %+v\n", req.err)
+			}
+			return
+		}
+
+		// 执行命令
+		if len(req.args) > 0 {
+			if err := c.WriteReply(s.handleCmd(ss, req.args[0], req.args[1:])); err != nil {
+				log.Printf("write reply err %+v\n", err)
+				return
+			}
+		}
+
+		// 没有等待执行的命令时发送回复
+		if len(reqs) == 0 || ss.quit {
+			if err := c.Flush(); err != nil {
+				log.Printf("write reply err %+v\n", err)
+				return
+			}
+		}
+		if ss.quit {
+			return
+		}
+	}
+}
+
+// 判断是否为客户端发送的数据格式错误
+func isProtocolError(err error) bool {
+	return errors.Is(err, ErrProtocol) || errors.Is(err, proto.ErrTooManyArgs) || errors.Is(err, proto.ErrArgTooLarge)
+}
+
+// 字节切片参数转化为字符串
+func toStrings(args [][]byte) []string {
+	res := make([]string, 0, len(args))
+	for _, arg := range args {
+		res = append(res, string(arg))
+	}
+	return res
+}
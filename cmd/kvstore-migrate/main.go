@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"github.com/pelletier/go-toml"
+	"io/ioutil"
+	"kvstore"
+	"kvstore/store"
+	"log"
+)
+
+var (
+	configPath = flag.String("c", "", "config of kvstore")
+	dirPath    = flag.String("d", kvstore.DefaultDirPath, "dir path of kvstore, ignored when config is given")
+	blockSize  = flag.Int64("b", kvstore.DefaultBlockSize, "block size of data files, ignored when config is given")
+)
+
+// 将没有文件头的旧格式数据文件升级为当前格式, 升级前需要关闭数据库
+func main() {
+	// 命令解析
+	flag.Parse()
+	cfg := kvstore.DefaultConfig()
+	cfg.DirPath, cfg.BlockSize = *dirPath, *blockSize
+	if *configPath != "" {
+		buf, err := ioutil.ReadFile(*configPath)
+		if err != nil {
+			log.Fatalf("load config failed : %s\n", err.Error())
+		}
+		if err := toml.Unmarshal(buf, cfg); err != nil {
+			log.Fatalf("load config failed : %s\n", err.Error())
+		}
+	}
+
+	// 升级
+	count, err := store.Migrate(cfg.DirPath, cfg.BlockSize)
+	if err == store.ErrAlreadyMigrated {
+		log.Printf("%s : %s\n", cfg.DirPath, err.Error())
+		return
+	}
+	if err != nil {
+		log.Fatalf("migrate %s failed : %s\n", cfg.DirPath, err.Error())
+	}
+	log.Printf("migrated %d entries in %s, legacy files are kept in %s%s%s\n",
+		count, cfg.DirPath, cfg.DirPath, store.PathSeparator, store.MigrateBackupDir)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"kvstore"
+	"kvstore/proto"
+	"strconv"
+)
+
+// Reply 命令的执行结果
+type Reply = proto.Reply
+
+var (
+	okReply  = statusReply("OK")
+	nilReply = Reply{Type: proto.NilReply}
+)
+
+func statusReply(s string) Reply {
+	return Reply{Type: proto.StatusReply, Str: s}
+}
+
+func errorReply(err error) Reply {
+	return Reply{Type: proto.ErrorReply, Str: err.Error()}
+}
+
+func intReply(n int) Reply {
+	return Reply{Type: proto.IntegerReply, Int: int64(n)}
+}
+
+func boolReply(b bool) Reply {
+	if b {
+		return intReply(1)
+	}
+	return intReply(0)
+}
+
+func bulkReply(data []byte) Reply {
+	return Reply{Type: proto.BulkReply, Str: string(data)}
+}
+
+func doubleReply(f float64) Reply {
+	return Reply{Type: proto.DoubleReply, Str: strconv.FormatFloat(f, 'g', -1, 64)}
+}
+
+// 多个值封装成数组
+func bulksReply(values [][]byte) Reply {
+	elems := make([]Reply, 0, len(values))
+	for _, v := range values {
+		elems = append(elems, bulkReply(v))
+	}
+	return Reply{Type: proto.ArrayReply, Elems: elems}
+}
+
+// 按键值交替排列的多个值封装成键值对
+func mapReply(values [][]byte) Reply {
+	r := bulksReply(values)
+	r.Type = proto.MapReply
+	return r
+}
+
+// 单个值的查询结果, 键不存在时返回空值
+func bulkOrNil(data []byte, err error) (Reply, error) {
+	if err == kvstore.ErrKeyNotExist {
+		return nilReply, nil
+	}
+	if err != nil {
+		return Reply{}, err
+	}
+	if data == nil {
+		return nilReply, nil
+	}
+	return bulkReply(data), nil
+}
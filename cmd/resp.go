@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"kvstore/proto"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrProtocol 客户端发送的数据不符合RESP协议
+var ErrProtocol = errors.New("Protocol error")
+
+const (
+	// 单条命令最多的参数数量
+	maxRESPArgs = 1024 * 1024
+
+	// 单个参数的最大长度
+	maxRESPBulkSize = 512 * 1024 * 1024
+)
+
+// RESP协议, 默认为RESP2, 客户端可以通过hello 3切换为RESP3
+type respCodec struct {
+	r  *bufio.Reader
+	w  *bufio.Writer
+	ss *session
+}
+
+func (c *respCodec) ReadCommand() ([]string, error) {
+	return readRESPCommand(c.r)
+}
+
+func (c *respCodec) WriteReply(r Reply) error {
+	writeRESP(c.w, r, c.ss.proto)
+	return nil
+}
+
+func (c *respCodec) Flush() error {
+	return c.w.Flush()
+}
+
+// 读取一条命令, 支持多条字符串组成的数组和以空白分隔的内联命令
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxRESPArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError("expected '$'")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxRESPBulkSize {
+			return nil, protocolError("invalid bulk length")
+		}
+
+		// 读取内容和结尾的换行符
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, protocolError("expected CRLF after bulk")
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// 读取一行, 去掉结尾的换行符
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", protocolError("too big request")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func protocolError(msg string) error {
+	return errors.New(ErrProtocol.Error() + ": " + msg)
+}
+
+// 按照RESP协议编码回复, version为3时使用RESP3的空值, 键值对和浮点数类型
+func writeRESP(w *bufio.Writer, r Reply, version int) {
+	switch r.Type {
+	case proto.StatusReply:
+		writeRESPLine(w, '+', oneLine(r.Str))
+	case proto.ErrorReply:
+		writeRESPLine(w, '-', errorCode(oneLine(r.Str)))
+	case proto.IntegerReply:
+		writeRESPLine(w, ':', strconv.FormatInt(r.Int, 10))
+	case proto.BulkReply:
+		writeRESPBulk(w, r.Str)
+	case proto.NilReply:
+		if version == 3 {
+			writeRESPLine(w, '_', "")
+		} else {
+			writeRESPLine(w, '$', "-1")
+		}
+	case proto.DoubleReply:
+		if version == 3 {
+			writeRESPLine(w, ',', r.Str)
+		} else {
+			writeRESPBulk(w, r.Str)
+		}
+	case proto.ArrayReply, proto.MapReply:
+		if r.Type == proto.MapReply && version == 3 {
+			writeRESPLine(w, '%', strconv.Itoa(len(r.Elems)/2))
+		} else {
+			writeRESPLine(w, '*', strconv.Itoa(len(r.Elems)))
+		}
+		for _, e := range r.Elems {
+			writeRESP(w, e, version)
+		}
+	}
+}
+
+func writeRESPLine(w *bufio.Writer, prefix byte, s string) {
+	_ = w.WriteByte(prefix)
+	_, _ = w.WriteString(s)
+	_, _ = w.WriteString("\r\n")
+}
+
+func writeRESPBulk(w *bufio.Writer, s string) {
+	writeRESPLine(w, '$', strconv.Itoa(len(s)))
+	_, _ = w.WriteString(s)
+	_, _ = w.WriteString("\r\n")
+}
+
+// 简单字符串和错误信息不能包含换行符
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// 错误信息以大写的错误类型开头, 没有错误类型时使用ERR
+func errorCode(msg string) string {
+	code := msg
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		code = msg[:i]
+	}
+	if code == "" || strings.IndexFunc(code, func(r rune) bool { return !unicode.IsUpper(r) }) >= 0 {
+		return "ERR " + msg
+	}
+	return msg
+}
@@ -2,18 +2,33 @@ package cmd
 
 import (
 	"bufio"
-	"encoding/binary"
+	"errors"
 	"fmt"
 	"kvstore"
+	"kvstore/proto"
 	"log"
 	"net"
-	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-var reg, _ = regexp.Compile(`'.*?'|".*?"|\S+`)
-type handleFunc  = func(*kvstore.Kvstore, []string) (string, error)
+// Version 服务器版本
+const Version = "1.0.0"
+
+var (
+	// ErrUnknownCmd 命令不存在
+	ErrUnknownCmd = errors.New("unknown command")
+
+	// ErrCmdPanic 命令执行时发生异常
+	ErrCmdPanic = errors.New("internal error when executing command")
+
+	// ErrNoProto 不支持的协议版本
+	ErrNoProto = errors.New("NOPROTO unsupported protocol version")
+)
+
+type handleFunc  = func(*kvstore.Kvstore, []string) (Reply, error)
 var Handles = make(map[string]handleFunc)
 
 // 添加命令处理函数
@@ -28,6 +43,8 @@ type server struct {
 	mu sync.Mutex
 	done chan struct{}
 	listener net.Listener
+	// 事务执行时加写锁, 普通命令执行时加读锁
+	txMu sync.RWMutex
 }
 
 // NewServer 返回一个数据库服务器
@@ -89,78 +106,110 @@ func (s *server) Listen(addr string) {
 
 func (s *server) handleConn(conn net.Conn) {
 	defer conn.Close()
-	for {
-		// 设置过期时间
-		_ = conn.SetReadDeadline(time.Now().Add(time.Hour * connInterval))
-
-		// 包装下conn
-		connReader := bufio.NewReader(conn)
-
-		// 读取长度
-		buf := make([]byte, 4)
-		_, err := connReader.Read(buf)
-		if err != nil {
-			// 写入日志
-			log.Printf("read cmd size err : %+v\n", err)
-			break
-		}
-
-		size := binary.BigEndian.Uint32(buf)
 
-		if size > 0 {
-			// 根据长度读取命令和数据
-			data := make([]byte, size)
-			_, err = connReader.Read(data)
-			if err != nil {
-				log.Printf("read cmd data err : %+v\n", err)
-				break
-			}
-			// 解码数据
-			cmdAndArgs := reg.FindAllString(string(data), -1)
-			// 执行命令
-			info := s.handleCmd(cmdAndArgs[0], cmdAndArgs[1:])
-			// 包装回复
-			reply := wrapReplyInfo(info)
-			// 回复客户端
-			if _, err := conn.Write(reply); err != nil {
-				log.Printf("write reply err %+v\n", err)
-			}
+	// 连接的事务状态, 连接关闭时取消监视
+	ss := newSession(s.kv)
+	defer ss.reset()
 
-		}
+	// 包装下conn
+	connReader := bufio.NewReader(conn)
+	connWriter := bufio.NewWriter(conn)
 
+	// 二进制协议以参数数量开头, 首字节为0; 其他情况按照RESP协议处理
+	_ = conn.SetReadDeadline(time.Now().Add(time.Hour * connInterval))
+	first, err := connReader.Peek(1)
+	if err != nil {
+		return
 	}
+	var c codec = &nativeCodec{r: connReader, w: connWriter}
+	if first[0] != 0 {
+		ss.proto = 2
+		c = &respCodec{r: connReader, w: connWriter, ss: ss}
+	}
+	s.serve(conn, c, ss)
 }
 
 // 执行命令统一接口
-func (s *server) handleCmd(cmd string, args []string) string {
+func (s *server) handleCmd(ss *session, cmd string, args []string) Reply {
+	// 命令名不区分大小写
+	cmd = strings.ToLower(cmd)
+
+	// 连接相关的命令
+	if reply, ok := s.handleConnCmd(ss, cmd, args); ok {
+		return reply
+	}
+
+	// 事务相关的命令
+	if reply, ok := s.handleTxCmd(ss, cmd, args); ok {
+		return reply
+	}
+
+	// 普通命令之间可以并发执行, 但不能与事务并发执行
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+	return s.execCmd(cmd, args)
+}
+
+// 执行单条命令
+func (s *server) execCmd(cmd string, args []string) (ret Reply) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("panic when executed cmd : %+v\n", r)
+			ret = errorReply(fmt.Errorf("%w '%s'", ErrCmdPanic, cmd))
 		}
 	}()
 
 	// 查看命令是否存在
 	handle, exist := Handles[cmd]
 	if !exist {
-		return "cmd not exist"
+		return errorReply(unknownCmd(cmd))
 	}
 	// 执行命令
 	ret, err := handle(s.kv, args)
 	if err != nil {
-		return fmt.Sprintf("err : %s", err.Error())
+		return errorReply(err)
 	}
-	fmt.Println(ret)
 	return ret
 }
 
-
-func wrapReplyInfo(info string) []byte {
-	reply := make([]byte, 4+len(info))
-	binary.BigEndian.PutUint32(reply[:4], uint32(len(info)))
-	copy(reply[4:], info)
-	return reply
+// 处理连接相关的命令, 返回false表示不是连接命令
+func (s *server) handleConnCmd(ss *session, cmd string, args []string) (Reply, bool) {
+	switch cmd {
+	case "hello":
+		// hello [protover], 切换RESP协议版本并返回服务器信息
+		if len(args) > 1 {
+			return errorReply(ErrSyntax), true
+		}
+		if len(args) == 1 {
+			version, err := strconv.Atoi(args[0])
+			if err != nil || (version != 2 && version != 3) {
+				return errorReply(ErrNoProto), true
+			}
+			if ss.proto != 0 {
+				ss.proto = version
+			}
+		}
+		return helloReply(ss.proto), true
+	case "quit":
+		ss.quit = true
+		return okReply, true
+	}
+	return Reply{}, false
 }
 
+// 服务器信息
+func helloReply(version int) Reply {
+	return Reply{Type: proto.MapReply, Elems: []Reply{
+		bulkReply([]byte("server")), bulkReply([]byte("kvstore")),
+		bulkReply([]byte("version")), bulkReply([]byte(Version)),
+		bulkReply([]byte("proto")), intReply(version),
+		bulkReply([]byte("mode")), bulkReply([]byte("standalone")),
+		bulkReply([]byte("role")), bulkReply([]byte("master")),
+		bulkReply([]byte("modules")), {Type: proto.ArrayReply},
+	}}
+}
 
-
-
+// 不存在的命令
+func unknownCmd(cmd string) error {
+	return fmt.Errorf("%w '%s'", ErrUnknownCmd, cmd)
+}
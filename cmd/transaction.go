@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"errors"
+	"kvstore"
+	"kvstore/proto"
+)
+
+var (
+	// ErrNestedMulti 事务不能嵌套
+	ErrNestedMulti = errors.New("MULTI calls can not be nested")
+
+	// ErrExecWithoutMulti 没有开启事务
+	ErrExecWithoutMulti = errors.New("EXEC without MULTI")
+
+	// ErrDiscardWithoutMulti 没有开启事务
+	ErrDiscardWithoutMulti = errors.New("DISCARD without MULTI")
+
+	// ErrWatchInMulti 事务中不能监视键
+	ErrWatchInMulti = errors.New("WATCH inside MULTI is not allowed")
+
+	// ErrExecAbort 事务中存在错误的命令, 事务被放弃
+	ErrExecAbort = errors.New("EXECABORT Transaction discarded because of previous errors")
+
+	// ErrWatchedKeyChanged 被监视的键发生了修改, 事务没有执行
+	ErrWatchedKeyChanged = errors.New("transaction aborted, watched keys changed")
+)
+
+// 排队等待执行的命令
+type queuedCmd struct {
+	cmd  string
+	args []string
+}
+
+// 每个连接的状态
+type session struct {
+	// RESP协议版本, 为0表示使用原有的长度前缀协议
+	proto int
+	// 客户端请求关闭连接
+	quit bool
+	// 是否处于事务中
+	multi bool
+	// 事务中排队的命令
+	queue []queuedCmd
+	// 排队时是否发生过错误
+	failed bool
+	// 监视的键
+	watcher *kvstore.Watcher
+}
+
+func newSession(kv *kvstore.Kvstore) *session {
+	return &session{watcher: kv.NewWatcher()}
+}
+
+// 清除事务状态, 同时取消监视
+func (ss *session) reset() {
+	ss.multi = false
+	ss.queue = nil
+	ss.failed = false
+	ss.watcher.Unwatch()
+}
+
+// 处理事务相关的命令, 返回false表示不是事务命令
+func (s *server) handleTxCmd(ss *session, cmd string, args []string) (Reply, bool) {
+	switch cmd {
+	case "multi":
+		if ss.multi {
+			return errorReply(ErrNestedMulti), true
+		}
+		ss.multi = true
+		return okReply, true
+	case "exec":
+		if !ss.multi {
+			return errorReply(ErrExecWithoutMulti), true
+		}
+		return s.exec(ss), true
+	case "discard":
+		if !ss.multi {
+			return errorReply(ErrDiscardWithoutMulti), true
+		}
+		ss.reset()
+		return okReply, true
+	case "watch":
+		if ss.multi {
+			return errorReply(ErrWatchInMulti), true
+		}
+		if len(args) == 0 {
+			return errorReply(ErrSyntax), true
+		}
+		ss.watcher.Watch(toBytes(args)...)
+		return okReply, true
+	case "unwatch":
+		ss.watcher.Unwatch()
+		return okReply, true
+	}
+
+	// 事务中的普通命令只排队, 不执行
+	if ss.multi {
+		if _, exist := Handles[cmd]; !exist {
+			ss.failed = true
+			return errorReply(unknownCmd(cmd)), true
+		}
+		ss.queue = append(ss.queue, queuedCmd{cmd: cmd, args: args})
+		return statusReply("QUEUED"), true
+	}
+	return Reply{}, false
+}
+
+// 执行事务, 执行期间其他连接的命令都会被阻塞
+func (s *server) exec(ss *session) Reply {
+	defer ss.reset()
+
+	if ss.failed {
+		return errorReply(ErrExecAbort)
+	}
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	// 被监视的键发生修改则放弃执行
+	if ss.watcher.Changed() {
+		return errorReply(ErrWatchedKeyChanged)
+	}
+
+	// 依次执行排队的命令, 单条命令失败不影响其他命令
+	replies := make([]Reply, 0, len(ss.queue))
+	for _, q := range ss.queue {
+		replies = append(replies, s.execCmd(q.cmd, q.args))
+	}
+	return Reply{Type: proto.ArrayReply, Elems: replies}
+}
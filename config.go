@@ -1,6 +1,11 @@
 package kvstore
 
-import "kvstore/store"
+import (
+	"kvstore/cache"
+	"kvstore/index"
+	"kvstore/store"
+	"time"
+)
 
 type IndexDataMode int8
 const (
@@ -8,6 +13,8 @@ const (
 	KeyValueMode IndexDataMode = iota
 	// OnlyKeyMode 只将键写入索引表模式
 	OnlyKeyMode
+	// DiskIndexMode 字符串的键和位置保存在磁盘上的B+树中, 用于键的数量超出内存的情况
+	DiskIndexMode
 )
 const (
 	// DefaultAddr 服务端地址
@@ -31,6 +38,33 @@ const (
 	// DefaultReWriteThreshold 默认数据库文件重写阈值
 	DefaultReWriteThreshold int = 4
 
+	// DefaultMergeInterval 默认后台合并间隔, 为0表示不定时合并
+	DefaultMergeInterval time.Duration = 0
+
+	// DefaultGarbageRatio 默认合并阈值, 垃圾数据比例达到该值的归档文件才会被合并
+	DefaultGarbageRatio = 0.5
+
+	// DefaultIndexType 默认字符串索引表的实现方式
+	DefaultIndexType = index.SkipListIndex
+
+	// DefaultExpireInterval 默认主动清理过期键的间隔, 为0表示只在读取时删除过期键
+	DefaultExpireInterval = 100 * time.Millisecond
+
+	// DefaultIndexCacheSize 默认磁盘索引表的页缓存大小
+	DefaultIndexCacheSize int64 = 4 * 1024 * 1024
+
+	// DefaultValueCacheSize 默认值缓存的大小, 只在值不保存在索引表中时使用, 为0表示不缓存
+	DefaultValueCacheSize int64 = 4 * 1024 * 1024
+
+	// DefaultValueCachePolicy 默认值缓存的淘汰策略
+	DefaultValueCachePolicy = cache.LRU
+
+	// DefaultMaxMemory 默认键值占用的内存上限, 为0表示不限制, 达到上限时只淘汰字符串键
+	DefaultMaxMemory int64 = 0
+
+	// DefaultEvictionPolicy 默认内存达到上限时的淘汰策略
+	DefaultEvictionPolicy = NoEviction
+
 )
 
 type Config struct {
@@ -38,11 +72,21 @@ type Config struct {
 	DirPath          string             `toml:"dir_path" json:"dir_path,omitempty"`
 	Method           store.FileRwMethod `toml:"method" json:"method,omitempty"`
 	IdxMode          IndexDataMode      `toml:"idx_mode" json:"idx_mode,omitempty"`
+	IndexType        index.Type         `toml:"index_type" json:"index_type,omitempty"`
 	BlockSize        int64              `toml:"block_size" json:"block_size,omitempty"`
 	Sync             bool               `toml:"sync" json:"sync,omitempty"`
 	MaxKeySize       uint32             `toml:"max_key_size" json:"max_key_size,omitempty"`
 	MaxValueSize     uint32             `toml:"max_value_size" json:"max_value_size,omitempty"`
 	ReWriteThreshold int                `toml:"re_write_threshold" json:"re_write_threshold,omitempty"`
+	MergeInterval    time.Duration      `toml:"merge_interval" json:"merge_interval,omitempty"`
+	GarbageRatio     float64            `toml:"garbage_ratio" json:"garbage_ratio,omitempty"`
+	StrictRecovery   bool               `toml:"strict_recovery" json:"strict_recovery,omitempty"`
+	ExpireInterval   time.Duration      `toml:"expire_interval" json:"expire_interval,omitempty"`
+	IndexCacheSize   int64              `toml:"index_cache_size" json:"index_cache_size,omitempty"`
+	ValueCacheSize   int64              `toml:"value_cache_size" json:"value_cache_size,omitempty"`
+	ValueCachePolicy cache.Policy       `toml:"value_cache_policy" json:"value_cache_policy,omitempty"`
+	MaxMemory        int64              `toml:"max_memory" json:"max_memory,omitempty"`
+	EvictionPolicy   EvictionPolicy     `toml:"eviction_policy" json:"eviction_policy,omitempty"`
 }
 
 func DefaultConfig() *Config {
@@ -51,10 +95,20 @@ func DefaultConfig() *Config {
 		DirPath: DefaultDirPath,
 		Method: DefaultMethod,
 		IdxMode: KeyValueMode,
+		IndexType: DefaultIndexType,
 		BlockSize: DefaultBlockSize,
 		Sync: false,
 		MaxKeySize: DefaultMaxKeySize,
 		MaxValueSize: DefaultMaxValueSize,
 		ReWriteThreshold: DefaultReWriteThreshold,
+		MergeInterval: DefaultMergeInterval,
+		GarbageRatio: DefaultGarbageRatio,
+		StrictRecovery: false,
+		ExpireInterval: DefaultExpireInterval,
+		IndexCacheSize: DefaultIndexCacheSize,
+		ValueCacheSize: DefaultValueCacheSize,
+		ValueCachePolicy: DefaultValueCachePolicy,
+		MaxMemory: DefaultMaxMemory,
+		EvictionPolicy: DefaultEvictionPolicy,
 	}
 }
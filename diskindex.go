@@ -0,0 +1,127 @@
+package kvstore
+
+import (
+	"kvstore/index"
+	"kvstore/store"
+	"log"
+)
+
+// 磁盘索引表的文件名
+const diskIndexFileName = "index.bpt"
+
+// 打开磁盘索引表, 检查点有效时重放只需要处理检查点之后的写入, 否则清空后全部重放
+func (k *Kvstore) openDiskIndex() error {
+	if k.config.MaxKeySize > index.MaxBPTreeKeySize {
+		return ErrKeySizeExceedsDiskIndex
+	}
+
+	pages := int(k.config.IndexCacheSize / index.PageSize)
+	tree, err := index.OpenBPTree(k.config.DirPath+store.PathSeparator+diskIndexFileName, pages)
+	if err != nil {
+		return err
+	}
+	k.strIndex.index = tree
+
+	if cp, ok := tree.Checkpoint(); ok && k.validCheckpoint(cp) {
+		k.strIndex.checkpoint = &cp
+		return nil
+	}
+	return tree.Reset()
+}
+
+// 判断检查点是否仍然在已经写入的数据之内
+func (k *Kvstore) validCheckpoint(cp index.Checkpoint) bool {
+	if cp.FileId > k.activeFileId {
+		return false
+	}
+	df := k.activeFile
+	if cp.FileId != k.activeFileId {
+		df = k.archFiles[cp.FileId]
+	}
+	// 检查点所在的文件已经被合并, 其中的写入都已经包含在索引表中
+	if df == nil {
+		return true
+	}
+	info, err := df.File.Stat()
+	return err == nil && cp.Offset <= info.Size()
+}
+
+// 判断entry是否已经包含在磁盘索引表中, 重放时跳过这些写入
+func (k *Kvstore) indexed(idx *index.Indexer) bool {
+	cp := k.strIndex.checkpoint
+	if cp == nil {
+		return false
+	}
+	return idx.FileId < cp.FileId || (idx.FileId == cp.FileId && idx.Offset < cp.Offset)
+}
+
+// 重放完成后提交磁盘索引表, 之后启动时从当前位置开始重放
+func (k *Kvstore) checkpointIndex() error {
+	tree, ok := k.diskIndex()
+	if !ok {
+		return nil
+	}
+	k.strIndex.checkpoint = nil
+	return k.commitIndex(tree)
+}
+
+// 重放期间磁盘索引表修改过的页较多时提交, 检查点为idx之后的位置, 避免重放时所有修改过的页都留在内存中
+// idx之前的字符串操作需要都已经写入索引表, 之后启动时不再重放
+func (k *Kvstore) commitReplayed(idx *index.Indexer) {
+	tree, ok := k.diskIndex()
+	if !ok || !tree.NeedCommit() {
+		return
+	}
+	cp := index.Checkpoint{FileId: idx.FileId, Offset: idx.Offset + int64(idx.EntrySize)}
+	if err := tree.Commit(cp); err != nil {
+		log.Printf("commit disk index err : %s\n", err.Error())
+	}
+}
+
+// 磁盘索引表修改过的页较多时提交, 在释放字符串索引表的写锁之前调用, 此时索引表包含了所有已经写入的字符串操作
+func (k *Kvstore) flushIndex() {
+	tree, ok := k.diskIndex()
+	if !ok || !tree.NeedCommit() {
+		return
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if err := k.commitIndex(tree); err != nil {
+		log.Printf("commit disk index err : %s\n", err.Error())
+	}
+}
+
+// 提交磁盘索引表并关闭
+func (k *Kvstore) closeIndex() error {
+	tree, ok := k.diskIndex()
+	if !ok {
+		return nil
+	}
+
+	// 加锁
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if err := k.commitIndex(tree); err != nil {
+		return err
+	}
+	return tree.Close()
+}
+
+// 同步活跃文件之后提交磁盘索引表, 检查点为活跃文件当前写入的位置
+// 调用方需持有字符串索引表的写锁和k.mu
+func (k *Kvstore) commitIndex(tree *index.BPTree) error {
+	if err := k.activeFile.Sync(); err != nil {
+		return err
+	}
+	return tree.Commit(index.Checkpoint{FileId: k.activeFileId, Offset: k.activeFile.Offset})
+}
+
+// 返回磁盘索引表, 不是磁盘索引表模式时返回false
+func (k *Kvstore) diskIndex() (*index.BPTree, bool) {
+	tree, ok := k.strIndex.index.(*index.BPTree)
+	return tree, ok
+}
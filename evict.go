@@ -0,0 +1,386 @@
+package kvstore
+
+import (
+	"errors"
+	"kvstore/store"
+	"math/rand"
+	"sync"
+)
+
+// EvictionPolicy 内存达到上限时的淘汰策略
+type EvictionPolicy string
+
+const (
+	// NoEviction 不淘汰, 拒绝会增加内存的写入
+	NoEviction EvictionPolicy = "noeviction"
+	// AllKeysLRU 在所有键中淘汰最久未访问的键
+	AllKeysLRU EvictionPolicy = "allkeys-lru"
+	// AllKeysLFU 在所有键中淘汰访问频率最低的键
+	AllKeysLFU EvictionPolicy = "allkeys-lfu"
+	// VolatileLRU 在设置了过期时间的键中淘汰最久未访问的键
+	VolatileLRU EvictionPolicy = "volatile-lru"
+	// VolatileTTL 在设置了过期时间的键中淘汰最早过期的键
+	VolatileTTL EvictionPolicy = "volatile-ttl"
+	// AllKeysRandom 在所有键中随机淘汰
+	AllKeysRandom EvictionPolicy = "allkeys-random"
+)
+
+var (
+	// ErrOutOfMemory 内存达到上限且无法淘汰键
+	ErrOutOfMemory = errors.New("kvstore: used memory exceeds max memory and no key can be evicted")
+
+	// ErrInvalidEvictionPolicy 淘汰策略不存在
+	ErrInvalidEvictionPolicy = errors.New("kvstore: invalid eviction policy")
+)
+
+const (
+	// 每次淘汰抽样的键数量, 从中选出最合适的键
+	evictionSamples = 5
+	// 每个键除了键值之外额外占用的内存估计
+	keyOverhead = 128
+	// 新键的访问频率计数, 避免刚写入的键立即被淘汰
+	lfuInitCount = 5
+	// 访问频率计数对数增长的因子, 越大增长越慢
+	lfuLogFactor = 10
+	// 访问频率计数每隔该时间(毫秒)未被访问减一
+	lfuDecayTime = 60 * 1000
+)
+
+// MemoryStats 内存上限和淘汰的统计信息
+type MemoryStats struct {
+	// Used 所有类型的键值占用的内存估计
+	Used int64
+	// MaxMemory 内存上限, 为0表示不限制
+	MaxMemory int64
+	// Policy 淘汰策略
+	Policy EvictionPolicy
+	// Evicted 被淘汰的键数量
+	Evicted uint64
+	// Rejected 因为内存不足而拒绝的写入次数
+	Rejected uint64
+}
+
+// 记录字符串的键占用的内存和访问情况, 只在设置了内存上限时使用, 其他类型占用的内存由各自的索引表统计
+// 键的集合由字符串索引表的写锁和mu保护, 读操作不一定持有字符串索引表的锁, 访问信息由mu保护
+type evictor struct {
+	mu   sync.Mutex
+	used int64
+	keys map[string]*keyUsage
+	// 访问的逻辑时钟, 每次访问加一, 用于比较访问的先后
+	tick  uint64
+	stats MemoryStats
+}
+
+type keyUsage struct {
+	// 占用的内存估计
+	cost int64
+	// 最后访问时的逻辑时钟
+	recency uint64
+	// 最后访问的时间, 以毫秒为单位, 用于衰减访问频率计数
+	access uint64
+	// 对数增长的访问频率计数
+	count uint8
+}
+
+// 检查淘汰策略是否存在, 在打开数据文件之前调用
+func checkEvictionPolicy(policy EvictionPolicy) error {
+	switch policy {
+	case "", NoEviction, AllKeysLRU, AllKeysLFU, VolatileLRU, VolatileTTL, AllKeysRandom:
+		return nil
+	}
+	return ErrInvalidEvictionPolicy
+}
+
+// 设置了内存上限时新建, 磁盘索引表模式下键不在内存中, 不限制内存
+func newEvictor(config *Config) *evictor {
+	if config.MaxMemory <= 0 || config.IdxMode == DiskIndexMode {
+		return nil
+	}
+	return &evictor{keys: make(map[string]*keyUsage)}
+}
+
+// MemoryStats 返回内存上限和淘汰的统计信息
+func (k *Kvstore) MemoryStats() MemoryStats {
+	st := MemoryStats{Policy: k.config.EvictionPolicy}
+	if k.evictor == nil {
+		return st
+	}
+
+	k.evictor.mu.Lock()
+	defer k.evictor.mu.Unlock()
+	st = k.evictor.stats
+	st.Used = k.evictor.used + k.collectionMemory()
+	st.MaxMemory = k.config.MaxMemory
+	st.Policy = k.config.EvictionPolicy
+	return st
+}
+
+// 哈希, 列表, 集合和有序集合占用的内存估计, 不需要持有对应索引表的锁
+func (k *Kvstore) collectionMemory() int64 {
+	return k.hashIndex.indexes.Memory() + k.listIndex.indexes.Memory() +
+		k.setIndex.indexes.Memory() + k.zsetIndex.indexes.Memory()
+}
+
+// 估计键值占用的内存, 只有键值模式下值保存在内存中
+func (k *Kvstore) memoryCost(key, value []byte) int64 {
+	cost := int64(2*len(key)) + keyOverhead
+	if k.config.IdxMode == KeyValueMode {
+		cost += int64(len(value))
+	}
+	return cost
+}
+
+// 键被写入索引表时记录占用的内存, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) trackKey(key, value []byte) {
+	if k.evictor == nil {
+		return
+	}
+
+	k.evictor.mu.Lock()
+	defer k.evictor.mu.Unlock()
+	u, exist := k.evictor.keys[string(key)]
+	if !exist {
+		u = &keyUsage{count: lfuInitCount}
+		k.evictor.keys[string(key)] = u
+	}
+	cost := k.memoryCost(key, value)
+	k.evictor.used += cost - u.cost
+	u.cost = cost
+	k.touchUsage(u)
+}
+
+// 键从索引表删除时释放占用的内存, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) untrackKey(key []byte) {
+	if k.evictor == nil {
+		return
+	}
+
+	k.evictor.mu.Lock()
+	defer k.evictor.mu.Unlock()
+	if u, exist := k.evictor.keys[string(key)]; exist {
+		k.evictor.used -= u.cost
+		delete(k.evictor.keys, string(key))
+	}
+}
+
+// 记录一次读取, 不需要持有字符串索引表的锁
+func (k *Kvstore) touchKey(key []byte) {
+	if k.evictor == nil {
+		return
+	}
+
+	k.evictor.mu.Lock()
+	defer k.evictor.mu.Unlock()
+	if u, exist := k.evictor.keys[string(key)]; exist {
+		k.touchUsage(u)
+	}
+}
+
+// 更新访问时间和访问频率计数, 调用方需持有k.evictor.mu
+func (k *Kvstore) touchUsage(u *keyUsage) {
+	now := k.now()
+	u.count = decayedCount(u, now)
+	// 计数越大增长的概率越小
+	if u.count < 255 {
+		base := 0.0
+		if u.count > lfuInitCount {
+			base = float64(u.count - lfuInitCount)
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			u.count++
+		}
+	}
+	u.access = now
+	k.evictor.tick++
+	u.recency = k.evictor.tick
+}
+
+// 根据未访问的时间衰减访问频率计数
+func decayedCount(u *keyUsage, now uint64) uint8 {
+	if now <= u.access {
+		return u.count
+	}
+	periods := (now - u.access) / lfuDecayTime
+	if periods >= uint64(u.count) {
+		return 0
+	}
+	return u.count - uint8(periods)
+}
+
+// 写入之前释放内存, 使写入之后占用的内存不超过上限, 调用方需持有字符串索引表的写锁
+// 淘汰所有可以淘汰的键仍然不够时直接拒绝写入, 不淘汰任何键
+func (k *Kvstore) freeMemory(entries ...*store.Entry) error {
+	if k.evictor == nil {
+		return nil
+	}
+
+	// 同一个键以最后一次写入为准, 写入的键不会被淘汰
+	final := make(map[string]int64)
+	for _, e := range entries {
+		switch e.Mark {
+		case StringSet:
+			final[string(e.Meta.Key)] = k.memoryCost(e.Meta.Key, e.Meta.Value)
+		case StringRem:
+			final[string(e.Meta.Key)] = 0
+		}
+	}
+
+	return k.evict(final, 0)
+}
+
+// 写入哈希, 列表, 集合和有序集合之前释放内存, cost为写入最多增加的内存
+// 只淘汰字符串键, 字符串索引表的锁需要在其他索引表的锁之前获取, 因此在加其他索引表的锁之前调用
+func (k *Kvstore) reserveMemory(cost int64) error {
+	if k.evictor == nil {
+		return nil
+	}
+
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	return k.evict(nil, cost)
+}
+
+// 淘汰键直到写入之后占用的内存不超过上限, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) evict(final map[string]int64, extra int64) error {
+	if excess := k.memoryGrowth(final, extra); excess > 0 && excess > k.reclaimable(final) {
+		k.rejectWrite()
+		return ErrOutOfMemory
+	}
+	for k.memoryGrowth(final, extra) > 0 {
+		key, ok := k.evictionCandidate(final)
+		if !ok {
+			k.rejectWrite()
+			return ErrOutOfMemory
+		}
+		if err := k.evictKey([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 记录一次因为内存不足而拒绝的写入
+func (k *Kvstore) rejectWrite() {
+	k.evictor.mu.Lock()
+	k.evictor.stats.Rejected++
+	k.evictor.mu.Unlock()
+}
+
+// 写入之后占用的内存超出上限的部分, final为写入之后各个字符串键占用的内存, extra为其他类型增加的内存
+// 调用方需持有字符串索引表的写锁
+func (k *Kvstore) memoryGrowth(final map[string]int64, extra int64) int64 {
+	k.evictor.mu.Lock()
+	defer k.evictor.mu.Unlock()
+	used := k.evictor.used + k.collectionMemory() + extra
+	for key, cost := range final {
+		if u, exist := k.evictor.keys[key]; exist {
+			used -= u.cost
+		}
+		used += cost
+	}
+	return used - k.config.MaxMemory
+}
+
+// 根据淘汰策略可以淘汰的键占用的内存总和, 不包括skip中的键, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) reclaimable(skip map[string]int64) int64 {
+	k.evictor.mu.Lock()
+	defer k.evictor.mu.Unlock()
+
+	var total int64
+	switch k.config.EvictionPolicy {
+	case AllKeysLRU, AllKeysLFU, AllKeysRandom:
+		for key, u := range k.evictor.keys {
+			if _, exist := skip[key]; !exist {
+				total += u.cost
+			}
+		}
+	case VolatileLRU, VolatileTTL:
+		for key := range k.expires {
+			if _, exist := skip[key]; exist {
+				continue
+			}
+			if u, exist := k.evictor.keys[key]; exist {
+				total += u.cost
+			}
+		}
+	}
+	return total
+}
+
+// 根据淘汰策略抽样选出被淘汰的键, 跳过skip中的键, 没有可以淘汰的键时返回false, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) evictionCandidate(skip map[string]int64) (string, bool) {
+	k.evictor.mu.Lock()
+	defer k.evictor.mu.Unlock()
+	now := k.now()
+
+	// 分数越小越优先淘汰
+	var victim string
+	var best uint64
+	found := false
+	consider := func(key string, score uint64) {
+		if !found || score < best {
+			victim, best, found = key, score, true
+		}
+	}
+
+	// 字典的遍历顺序是随机的, 直接取前若干个键作为样本
+	sampled := 0
+	skipped := func(key string) bool {
+		_, exist := skip[key]
+		return exist
+	}
+	switch k.config.EvictionPolicy {
+	case AllKeysRandom:
+		for key := range k.evictor.keys {
+			if !skipped(key) {
+				return key, true
+			}
+		}
+	case AllKeysLRU, AllKeysLFU:
+		for key, u := range k.evictor.keys {
+			if sampled == evictionSamples {
+				break
+			}
+			if skipped(key) {
+				continue
+			}
+			sampled++
+			if k.config.EvictionPolicy == AllKeysLRU {
+				consider(key, u.recency)
+			} else {
+				consider(key, uint64(decayedCount(u, now)))
+			}
+		}
+	case VolatileLRU, VolatileTTL:
+		for key, deadline := range k.expires {
+			if sampled == evictionSamples {
+				break
+			}
+			if skipped(key) {
+				continue
+			}
+			sampled++
+			if k.config.EvictionPolicy == VolatileTTL {
+				consider(key, deadline)
+			} else if u, exist := k.evictor.keys[key]; exist {
+				consider(key, u.recency)
+			}
+		}
+	}
+	return victim, found
+}
+
+// 淘汰键, 与删除一样写入删除标记, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) evictKey(key []byte) error {
+	k.saveVersion(key)
+	k.clearExpire(key)
+	k.removeIndexer(key)
+	if err := k.store(store.NewNoExtraEntry(key, nil, String, StringRem)); err != nil {
+		return err
+	}
+
+	k.evictor.mu.Lock()
+	k.evictor.stats.Evicted++
+	k.evictor.mu.Unlock()
+	return nil
+}
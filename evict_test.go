@@ -0,0 +1,96 @@
+package kvstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvictOversizedWrite(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemory = 1000
+	config.EvictionPolicy = AllKeysLRU
+	kv := openTestKv(t, config)
+	defer kv.Close()
+
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		if err := kv.Set([]byte(key), make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 淘汰所有的键也放不下, 直接拒绝, 不淘汰任何键
+	if err := kv.Set([]byte("big"), make([]byte, 900)); err != ErrOutOfMemory {
+		t.Fatalf("set big: got %v, want %v", err, ErrOutOfMemory)
+	}
+	for _, key := range keys {
+		if _, err := kv.Get([]byte(key)); err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+	}
+	if st := kv.MemoryStats(); st.Evicted != 0 || st.Rejected != 1 {
+		t.Fatalf("stats: evicted %d, rejected %d", st.Evicted, st.Rejected)
+	}
+
+	// 淘汰部分键可以放下时正常写入
+	if err := kv.Set([]byte("d"), make([]byte, 500)); err != nil {
+		t.Fatal(err)
+	}
+	if st := kv.MemoryStats(); st.Evicted != 2 || st.Used > st.MaxMemory {
+		t.Fatalf("stats: evicted %d, used %d", st.Evicted, st.Used)
+	}
+}
+
+// 其他类型计入内存上限, 写入时只淘汰字符串键
+func TestEvictForCollections(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemory = 2000
+	kv := openTestKv(t, config)
+	defer kv.Close()
+
+	for i := 0; ; i++ {
+		_, err := kv.HSet([]byte("h"), []byte(fmt.Sprintf("f%d", i)), make([]byte, 100))
+		if err == ErrOutOfMemory {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 100 {
+			t.Fatal("hash writes never hit max memory")
+		}
+	}
+	if st := kv.MemoryStats(); st.Used > st.MaxMemory || st.Used < st.MaxMemory/2 {
+		t.Fatalf("used %d, max memory %d", st.Used, st.MaxMemory)
+	}
+	if err := kv.Set([]byte("s"), make([]byte, 100)); err != ErrOutOfMemory {
+		t.Fatalf("set: got %v, want %v", err, ErrOutOfMemory)
+	}
+}
+
+func TestEvictStringsForCollections(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemory = 2000
+	config.EvictionPolicy = AllKeysLRU
+	kv := openTestKv(t, config)
+	defer kv.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := kv.Set([]byte(fmt.Sprintf("s%d", i)), make([]byte, 200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 列表的写入淘汰字符串键腾出内存
+	for i := 0; i < 5; i++ {
+		if _, err := kv.RPush([]byte("l"), make([]byte, 200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := kv.MemoryStats()
+	if st.Evicted == 0 || st.Used > st.MaxMemory {
+		t.Fatalf("evicted %d, used %d, max memory %d", st.Evicted, st.Used, st.MaxMemory)
+	}
+	if n := kv.LLen([]byte("l")); n != 5 {
+		t.Fatalf("llen: got %d, want 5", n)
+	}
+}
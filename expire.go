@@ -0,0 +1,210 @@
+package kvstore
+
+import (
+	"kvstore/store"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// 每轮抽样检查的键数量
+	expireSampleSize = 20
+
+	// 抽样中过期键的比例超过该值时继续下一轮
+	expireRepeatRatio = 0.25
+
+	// 每次清理最多占用清理间隔的比例
+	expireTimeRatio = 0.25
+)
+
+// 旧版本保存过期字典的文件, 现在过期时间以entry写入数据文件, 打开数据库时迁移
+var legacyExpiresPath = "/tmp/kvStore/expires.data"
+
+// Clock 判断键是否过期使用的时钟
+type Clock interface {
+	Now() time.Time
+}
+
+// 系统时钟
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// atomic.Value要求每次保存的类型一致, 因此包装一层
+type clockValue struct {
+	Clock
+}
+
+// SetClock 替换判断键是否过期使用的时钟, 为空时恢复系统时钟, 用于在测试中控制时间
+func (k *Kvstore) SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+
+	// 加锁
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	k.clock.Store(clockValue{c})
+}
+
+// 返回以毫秒为单位的当前时间
+func (k *Kvstore) now() uint64 {
+	return uint64(k.clock.Load().(clockValue).Now().UnixNano() / int64(time.Millisecond))
+}
+
+// ExpireStats 主动过期的统计信息
+type ExpireStats struct {
+	// Cycles 清理次数
+	Cycles uint64
+	// Sampled 抽样检查的键数量
+	Sampled uint64
+	// Expired 删除的过期键数量
+	Expired uint64
+	// TimeLimitHits 因为达到时间上限而提前结束的清理次数
+	TimeLimitHits uint64
+	// LastExpiredRatio 上一次清理中过期键所占的比例
+	LastExpiredRatio float64
+	// LastDuration 上一次清理的耗时
+	LastDuration time.Duration
+}
+
+// 后台主动过期的状态
+type expirer struct {
+	mu    sync.Mutex
+	stats ExpireStats
+	// 关闭数据库时通知后台清理协程退出
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newExpirer() *expirer {
+	return &expirer{stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// ExpireStats 返回主动过期的统计信息
+func (k *Kvstore) ExpireStats() ExpireStats {
+	k.expirer.mu.Lock()
+	defer k.expirer.mu.Unlock()
+	return k.expirer.stats
+}
+
+// 定时清理过期键, 直到数据库关闭
+func (k *Kvstore) runExpirer(interval time.Duration) {
+	defer close(k.expirer.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	budget := time.Duration(float64(interval) * expireTimeRatio)
+	for {
+		select {
+		case <-k.expirer.stop:
+			return
+		case <-ticker.C:
+			k.expireCycle(budget)
+		}
+	}
+}
+
+// 通知后台清理协程退出, 并等待其结束
+func (k *Kvstore) stopExpirer() {
+	select {
+	case <-k.expirer.stop:
+		return
+	default:
+		close(k.expirer.stop)
+	}
+	if k.config.ExpireInterval > 0 {
+		<-k.expirer.done
+	}
+}
+
+// 一次清理: 随机抽样检查带有过期时间的键, 过期键较多时继续抽样, 直到比例降低或者达到时间上限
+func (k *Kvstore) expireCycle(budget time.Duration) {
+	start := time.Now()
+	var sampled, expired int
+	timeout := false
+	for {
+		s, e := k.expireSample()
+		sampled += s
+		expired += e
+		if s == 0 || float64(e) <= float64(s)*expireRepeatRatio {
+			break
+		}
+		if time.Since(start) > budget {
+			timeout = true
+			break
+		}
+	}
+
+	k.expirer.mu.Lock()
+	defer k.expirer.mu.Unlock()
+	st := &k.expirer.stats
+	st.Cycles++
+	st.Sampled += uint64(sampled)
+	st.Expired += uint64(expired)
+	if timeout {
+		st.TimeLimitHits++
+	}
+	st.LastExpiredRatio = 0
+	if sampled > 0 {
+		st.LastExpiredRatio = float64(expired) / float64(sampled)
+	}
+	st.LastDuration = time.Since(start)
+}
+
+// 抽样检查一轮, 删除其中过期的键, 返回检查和删除的键数量
+func (k *Kvstore) expireSample() (sampled, expired int) {
+	// 加锁
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	defer k.flushIndex()
+
+	// 字典的遍历顺序是随机的, 直接取前若干个键作为样本
+	var keys []string
+	for key := range k.expires {
+		if sampled == expireSampleSize {
+			break
+		}
+		sampled++
+		if k.expired([]byte(key)) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		if err := k.removeExpired([]byte(key)); err != nil {
+			log.Printf("remove expires %s, %s\n", key, err.Error())
+			continue
+		}
+		expired++
+	}
+	return
+}
+
+// 将旧版本保存在单独文件中的过期时间写入数据文件, 迁移完成后删除旧文件
+func (k *Kvstore) migrateExpires() error {
+	expires, err := store.LoadExpires(legacyExpiresPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for key, deadline := range expires {
+		// 数据文件中已有的过期时间更新, 不覆盖
+		if _, exist := k.expires[key]; exist {
+			continue
+		}
+		// 旧版本的过期时间以秒为单位, 键已经不存在时忽略, 已经过期的键直接删除
+		if err := k.PExpireAt([]byte(key), deadline*1000); err != nil && err != ErrKeyNotExist {
+			return err
+		}
+	}
+	log.Printf("migrate %d expires from %s\n", len(expires), legacyExpiresPath)
+	return os.Remove(legacyExpiresPath)
+}
@@ -0,0 +1,69 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 按照旧版本的格式写入过期字典, 过期时间以秒为单位
+func writeLegacyExpires(t *testing.T, path string, expires map[string]uint64) {
+	t.Helper()
+	var buf []byte
+	for key, deadline := range expires {
+		head := make([]byte, 12)
+		binary.BigEndian.PutUint32(head[:4], uint32(len(key)))
+		binary.BigEndian.PutUint64(head[4:], deadline)
+		buf = append(append(buf, head...), key...)
+	}
+	if err := ioutil.WriteFile(path, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyExpires(t *testing.T) {
+	config := testConfig(t)
+	old := legacyExpiresPath
+	legacyExpiresPath = filepath.Join(config.DirPath, "expires.data")
+	defer func() { legacyExpiresPath = old }()
+
+	kv := openTestKv(t, config)
+	for _, key := range []string{"live", "dead", "persist"} {
+		if err := kv.Set([]byte(key), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint64(time.Now().Unix())
+	writeLegacyExpires(t, legacyExpiresPath, map[string]uint64{
+		"live":    now + 3600,
+		"dead":    now - 1,
+		"missing": now + 3600,
+	})
+	kv = openTestKv(t, config)
+	if _, err := os.Stat(legacyExpiresPath); !os.IsNotExist(err) {
+		t.Fatalf("legacy expires file not removed: %v", err)
+	}
+
+	// 迁移之后过期时间保存在数据文件中, 重新打开仍然有效
+	kv = reopenTestKv(t, kv, config)
+	defer kv.Close()
+	if ttl, err := kv.TTL([]byte("live")); err != nil || ttl == 0 || ttl > 3600 {
+		t.Fatalf("ttl live: got %d, %v", ttl, err)
+	}
+	if _, err := kv.Get([]byte("dead")); err != ErrKeyNotExist {
+		t.Fatalf("get dead: got %v, want %v", err, ErrKeyNotExist)
+	}
+	if _, err := kv.TTL([]byte("persist")); err != ErrKeyIsPermanent {
+		t.Fatalf("ttl persist: got %v, want %v", err, ErrKeyIsPermanent)
+	}
+	if _, err := kv.Get([]byte("missing")); err != ErrKeyNotExist {
+		t.Fatalf("get missing: got %v, want %v", err, ErrKeyNotExist)
+	}
+}
@@ -1,20 +1,80 @@
 package kvstore
 
 import (
+	"fmt"
 	"io"
 	"kvstore/index"
 	"kvstore/store"
+	"log"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 const (
 	String uint16 = iota
+	Hash
+	List
+	Set
+	ZSet
+	// Batch 批量写入的起止标记, 不属于任何数据类型
+	Batch
 )
 
+// ExtraSeparator 额外信息中多个参数的分隔符
+const ExtraSeparator = " "
+
+
 // 字符串相关操作类型标识符
 const (
 	StringSet uint16 = iota
 	StringRem
+	// StringSnapshot 重写数据库文件时保留的被快照引用的历史版本, 重放时忽略
+	StringSnapshot
+	// StringExpire 设置过期时间, 以秒为单位的过期时间保存在额外信息中, 只在旧的数据文件中出现
+	StringExpire
+	// StringPExpire 设置过期时间, 以毫秒为单位的过期时间保存在额外信息中
+	StringPExpire
+	// StringPersist 删除过期时间
+	StringPersist
+)
+
+// 哈希表相关操作类型标识符
+const (
+	HashHSet uint16 = iota
+	HashHDel
+)
+
+// 列表相关操作类型标识符
+const (
+	ListLPush uint16 = iota
+	ListRPush
+	ListLPop
+	ListRPop
+	ListLSet
+	ListLRem
+	ListLTrim
+)
+
+// 集合相关操作类型标识符
+const (
+	SetSAdd uint16 = iota
+	SetSRem
+)
+
+// 有序集合相关操作类型标识符
+const (
+	ZSetZAdd uint16 = iota
+	ZSetZRem
+)
+
+// 批量写入相关标记
+const (
+	BatchBegin uint16 = iota
+	BatchCommit
+	// BatchAbort 重启时发现未提交的批量写入, 写入该标记使后续的数据不再属于该批量写入
+	BatchAbort
 )
 
 // 字符串索引表操作
@@ -23,9 +83,98 @@ func(k *Kvstore) buildStringIndex(idx *index.Indexer, opt uint16) {
 
 	switch opt {
 	case StringSet:
-		k.strIndex.skl.Insert(idx.Meta.Key, idx)
+		// 被覆盖的entry失效, 磁盘索引表已经包含的写入不再重放, 失效数据以保存的统计为准
+		if !k.indexed(idx) {
+			if old := k.strIndex.index.Put(idx.Meta.Key, idx); old != nil {
+				k.addGarbage(old)
+			}
+			k.trackKey(idx.Meta.Key, idx.Meta.Value)
+		}
+		k.clearExpire(idx.Meta.Key)
 	case StringRem:
-		k.strIndex.skl.Remove(idx.Meta.Key)
+		if !k.indexed(idx) {
+			k.removeIndexer(idx.Meta.Key)
+		}
+		k.clearExpire(idx.Meta.Key)
+	case StringExpire, StringPExpire:
+		// 过期时间只对已经存在的键有效
+		if k.strIndex.index.Get(idx.Meta.Key) == nil {
+			return
+		}
+		if deadline, ok := expireDeadline(idx.Meta.Extra, opt); ok {
+			k.setExpire(idx.Meta.Key, deadline)
+		}
+	case StringPersist:
+		k.clearExpire(idx.Meta.Key)
+	}
+}
+
+// 哈希索引表操作, 哈希表的字段保存在额外信息中
+func (k *Kvstore) buildHashIndex(idx *index.Indexer, opt uint16) {
+	key, field := string(idx.Meta.Key), string(idx.Meta.Extra)
+
+	switch opt {
+	case HashHSet:
+		k.hashIndex.indexes.HSet(key, field, idx.Meta.Value)
+	case HashHDel:
+		k.hashIndex.indexes.HDel(key, field)
+	}
+}
+
+// 列表索引表操作, 下标等参数保存在额外信息中
+func (k *Kvstore) buildListIndex(idx *index.Indexer, opt uint16) {
+	key := string(idx.Meta.Key)
+
+	switch opt {
+	case ListLPush:
+		k.listIndex.indexes.LPush(key, idx.Meta.Value)
+	case ListRPush:
+		k.listIndex.indexes.RPush(key, idx.Meta.Value)
+	case ListLPop:
+		k.listIndex.indexes.LPop(key)
+	case ListRPop:
+		k.listIndex.indexes.RPop(key)
+	case ListLSet:
+		if i, err := strconv.Atoi(string(idx.Meta.Extra)); err == nil {
+			k.listIndex.indexes.LSet(key, i, idx.Meta.Value)
+		}
+	case ListLRem:
+		if count, err := strconv.Atoi(string(idx.Meta.Extra)); err == nil {
+			k.listIndex.indexes.LRem(key, idx.Meta.Value, count)
+		}
+	case ListLTrim:
+		args := strings.Split(string(idx.Meta.Extra), ExtraSeparator)
+		if len(args) == 2 {
+			start, _ := strconv.Atoi(args[0])
+			end, _ := strconv.Atoi(args[1])
+			k.listIndex.indexes.LTrim(key, start, end)
+		}
+	}
+}
+
+// 集合索引表操作
+func (k *Kvstore) buildSetIndex(idx *index.Indexer, opt uint16) {
+	key := string(idx.Meta.Key)
+
+	switch opt {
+	case SetSAdd:
+		k.setIndex.indexes.SAdd(key, idx.Meta.Value)
+	case SetSRem:
+		k.setIndex.indexes.SRem(key, idx.Meta.Value)
+	}
+}
+
+// 有序集合索引表操作, 分数保存在额外信息中
+func (k *Kvstore) buildZSetIndex(idx *index.Indexer, opt uint16) {
+	key := string(idx.Meta.Key)
+
+	switch opt {
+	case ZSetZAdd:
+		if score, err := strconv.ParseFloat(string(idx.Meta.Extra), 64); err == nil {
+			k.zsetIndex.indexes.ZAdd(key, score, idx.Meta.Value)
+		}
+	case ZSetZRem:
+		k.zsetIndex.indexes.ZRem(key, idx.Meta.Value)
 	}
 }
 
@@ -47,13 +196,52 @@ func (k  *Kvstore) loadIdxFromFiles() error {
 	// 排序文件编号
 	sort.Ints(fileIds)
 
+	// 未提交的批量写入, 可能跨越多个文件
+	var batch *pendingBatch
+
+	// 写入索引表, 批量写入中的数据等到提交标记出现后再写入
+	replay := func(e *store.Entry, idx *index.Indexer) {
+		k.countEntry(idx, e)
+		switch {
+		case e.Type == Batch:
+			batch = k.replayBatch(batch, e)
+		case batch != nil:
+			batch.add(e, idx)
+		default:
+			k.buildIndex(e, idx)
+		}
+		// 没有未提交的批量写入时, 之前的字符串操作都已经写入索引表
+		if batch == nil {
+			k.commitReplayed(idx)
+		}
+	}
+
 	// 按照文件顺序依次执行命令建立索引表
 	for i := 0; i < len(fileIds); i++ {
 		fid := uint32(fileIds[i])
 		df :=  kvFiles[fid]
-		var offset int64 = 0
+		active := i == len(fileIds)-1
+
+		// 归档文件优先从索引文件加载, 索引文件不存在或损坏时读取数据文件
+		if !active {
+			hints, end, err := store.LoadHints(k.config.DirPath, fid)
+			if err == nil && k.validHints(df, end) {
+				if err := k.loadIdxFromHints(df, hints, replay); err != nil {
+					return err
+				}
+				df.Offset = end
+				continue
+			}
+			if !os.IsNotExist(err) {
+				log.Printf("hint file of %06d is invalid, load from data file\n", fid)
+			}
+		}
+
+		var hints []*store.Hint
+		var offset int64 = store.FileHeaderSize
 		for offset <= k.config.BlockSize {
-			if e, err := df.Read(offset); err == nil {
+			e, err := df.Read(offset)
+			if err == nil {
 				// 根据entry  建立索引信息
 				idx := &index.Indexer{
 					Meta: e.Meta,
@@ -61,25 +249,44 @@ func (k  *Kvstore) loadIdxFromFiles() error {
 					EntrySize: e.Size(),
 					Offset: offset,
 				}
-				// 写入索引表
-				k.buildIndex(e, idx)
+				replay(e, idx)
+				hints = append(hints, store.NewHint(e, fid, offset))
 
 				// 修改偏移
 				offset += int64(e.Size())
-			} else {
-				if err == io.EOF {
-					break
-				}
+				continue
+			}
+			// 归档文件不会再写入, 损坏时无法修复; 活跃文件末尾的数据可能写入不完整, 之后截断
+			if err != io.EOF && !active {
+				return fmt.Errorf("%w: %06d.data at offset %d: %s", ErrCorruptedFile, fid, offset, err.Error())
+			}
+			break
+		}
+
+		// 活跃文件末尾残留不完整的数据时截断
+		if active {
+			if err := k.repairTail(df, offset); err != nil {
 				return err
 			}
 		}
 
 		// 更改偏移地址
 		df.Offset = offset
-		if i < len(fileIds)-1 {
-			if err := df.Close(true); err != nil {
-				return err
-			}
+
+		// 活跃文件的索引记录在归档时写入索引文件, 归档文件缺少索引文件时重新生成
+		if active {
+			k.activeHints = hints
+		} else if err := store.SaveHints(k.config.DirPath, fid, hints); err != nil {
+			log.Printf("save hint file of %06d err : %s\n", fid, err.Error())
+		}
+	}
+
+	// 丢弃未提交的批量写入, 并写入终止标记
+	if batch != nil {
+		log.Printf("discard uncommitted batch with %d entries\n", len(batch.entries))
+		k.discardBatch(batch)
+		if err := k.store(store.NewNoExtraEntry(batch.id, nil, Batch, BatchAbort)); err != nil {
+			return err
 		}
 	}
 
@@ -87,3 +294,54 @@ func (k  *Kvstore) loadIdxFromFiles() error {
 	return nil
 }
 
+
+// 根据索引文件建立索引表, 字符串在只有键的模式下不需要读取数据文件
+func (k *Kvstore) loadIdxFromHints(df *store.KvFile, hints []*store.Hint, replay func(*store.Entry, *index.Indexer)) error {
+	for _, h := range hints {
+		var e *store.Entry
+		if h.Type == String && !isExpireMark(h.Mark) && k.config.IdxMode != KeyValueMode {
+			e = &store.Entry{
+				Meta: &store.Meta{Key: h.Key, KeySize: uint32(len(h.Key))},
+				Type: h.Type,
+				Mark: h.Mark,
+			}
+		} else {
+			var err error
+			if e, err = df.Read(h.Offset); err != nil {
+				return err
+			}
+		}
+
+		idx := &index.Indexer{
+			Meta: e.Meta,
+			FileId: h.FileId,
+			EntrySize: h.EntrySize,
+			Offset: h.Offset,
+		}
+		replay(e, idx)
+	}
+	return nil
+}
+
+// 判断索引文件记录的有效长度是否与数据文件相符
+func (k *Kvstore) validHints(df *store.KvFile, end int64) bool {
+	info, err := df.File.Stat()
+	if err != nil {
+		return false
+	}
+	return end <= info.Size() && end <= k.config.BlockSize
+}
+
+// 截断活跃文件末尾写入不完整的数据, 严格模式下拒绝打开数据库
+func (k *Kvstore) repairTail(df *store.KvFile, offset int64) error {
+	tail, err := df.TailSize(offset)
+	if err != nil || tail == 0 {
+		return err
+	}
+	if k.config.StrictRecovery {
+		return fmt.Errorf("%w: %06d.data has %d bytes of incomplete data at offset %d", ErrCorruptedFile, df.Id, tail, offset)
+	}
+
+	log.Printf("truncate %06d.data at offset %d, drop %d bytes of incomplete data\n", df.Id, offset, tail)
+	return df.Truncate(offset)
+}
@@ -0,0 +1,464 @@
+package index
+
+import "bytes"
+
+// 内部节点的类型, 根据子节点数量在四种容量之间切换
+const (
+	node4 uint8 = iota
+	node16
+	node48
+	node256
+)
+
+// 各类型节点的子节点容量
+var nodeCapacity = [...]int{node4: 4, node16: 16, node48: 48, node256: 256}
+
+type (
+	// ART 基于自适应基数树的字符串索引表
+	ART struct {
+		root *artNode
+		size int
+	}
+
+	// 基数树节点, 从根节点到当前节点经过的字节为键的前缀
+	artNode struct {
+		// 压缩的路径, 只有一个子节点的路径合并到子节点中
+		prefix []byte
+		// 在该节点结束的键
+		leaf *artLeaf
+
+		kind uint8
+		size int
+		// node4和node16: 子节点对应的字节, 有序排列
+		// node48: 长度为256, 字节 -> 子节点位置加一, 为0表示没有子节点
+		// node256: 不使用, 子节点直接按字节存放
+		keys     []byte
+		children []*artNode
+	}
+
+	artLeaf struct {
+		key   []byte
+		value *Indexer
+	}
+)
+
+// NewART 建立基于自适应基数树的字符串索引表
+func NewART() *ART {
+	return &ART{}
+}
+
+// Get 查询键的索引信息
+func (t *ART) Get(key []byte) *Indexer {
+	n := t.root
+	for n != nil {
+		if !bytes.HasPrefix(key, n.prefix) {
+			return nil
+		}
+		key = key[len(n.prefix):]
+		if len(key) == 0 {
+			if n.leaf == nil {
+				return nil
+			}
+			return n.leaf.value
+		}
+		n = n.child(key[0])
+		key = key[1:]
+	}
+	return nil
+}
+
+// Put 插入或更新键的索引信息, 返回旧的索引信息
+func (t *ART) Put(key []byte, idx *Indexer) *Indexer {
+	old, exist := t.insert(&t.root, key, &artLeaf{key: key, value: idx})
+	if !exist {
+		t.size++
+	}
+	return old
+}
+
+// Delete 删除键, 返回被删除的索引信息
+func (t *ART) Delete(key []byte) *Indexer {
+	old, exist := t.remove(&t.root, key)
+	if exist {
+		t.size--
+	}
+	return old
+}
+
+// Iterator 返回按键的字节序遍历的迭代器
+func (t *ART) Iterator() Iterator {
+	return &iterator{s: t}
+}
+
+// Len 返回键的数量
+func (t *ART) Len() int {
+	return t.size
+}
+
+func (t *ART) seek(key []byte) ([]byte, *Indexer) {
+	if t.root == nil {
+		return nil, nil
+	}
+	return t.root.seek(key).get()
+}
+
+func (t *ART) seekBefore(key []byte) ([]byte, *Indexer) {
+	if t.root == nil {
+		return nil, nil
+	}
+	if key == nil {
+		return t.root.maximum().get()
+	}
+	return t.root.seekBefore(key).get()
+}
+
+// 在ref指向的子树中插入, key为相对子树的剩余部分
+func (t *ART) insert(ref **artNode, key []byte, leaf *artLeaf) (*Indexer, bool) {
+	n := *ref
+	if n == nil {
+		*ref = newArtLeafNode(key, leaf)
+		return nil, false
+	}
+
+	// 前缀不匹配时分裂出新的父节点
+	p := commonPrefix(n.prefix, key)
+	if p < len(n.prefix) {
+		parent := newArtNode(n.prefix[:p])
+		parent.addChild(n.prefix[p], n)
+		n.prefix = n.prefix[p+1:]
+		if p == len(key) {
+			parent.leaf = leaf
+		} else {
+			parent.addChild(key[p], newArtLeafNode(key[p+1:], leaf))
+		}
+		*ref = parent
+		return nil, false
+	}
+
+	key = key[p:]
+	if len(key) == 0 {
+		if n.leaf == nil {
+			n.leaf = leaf
+			return nil, false
+		}
+		old := n.leaf.value
+		n.leaf = leaf
+		return old, true
+	}
+
+	next := n.childRef(key[0])
+	if next == nil {
+		n.addChild(key[0], newArtLeafNode(key[1:], leaf))
+		return nil, false
+	}
+	return t.insert(next, key[1:], leaf)
+}
+
+// 从ref指向的子树中删除, 删除后合并只有一个子节点的路径
+func (t *ART) remove(ref **artNode, key []byte) (*Indexer, bool) {
+	n := *ref
+	if n == nil || !bytes.HasPrefix(key, n.prefix) {
+		return nil, false
+	}
+
+	key = key[len(n.prefix):]
+	var old *Indexer
+	if len(key) == 0 {
+		if n.leaf == nil {
+			return nil, false
+		}
+		old, n.leaf = n.leaf.value, nil
+	} else {
+		next := n.childRef(key[0])
+		if next == nil {
+			return nil, false
+		}
+		var exist bool
+		if old, exist = t.remove(next, key[1:]); !exist {
+			return nil, false
+		}
+		if *next == nil {
+			n.removeChild(key[0])
+		}
+	}
+
+	if n.leaf == nil {
+		switch n.size {
+		case 0:
+			*ref = nil
+		case 1:
+			c, child := n.next(-1)
+			prefix := make([]byte, 0, len(n.prefix)+1+len(child.prefix))
+			prefix = append(append(append(prefix, n.prefix...), c), child.prefix...)
+			child.prefix = prefix
+			*ref = child
+		}
+	}
+	return old, true
+}
+
+func newArtNode(prefix []byte) *artNode {
+	return &artNode{
+		prefix:   append([]byte(nil), prefix...),
+		kind:     node4,
+		keys:     make([]byte, nodeCapacity[node4]),
+		children: make([]*artNode, nodeCapacity[node4]),
+	}
+}
+
+func newArtLeafNode(prefix []byte, leaf *artLeaf) *artNode {
+	n := newArtNode(prefix)
+	n.leaf = leaf
+	return n
+}
+
+func (l *artLeaf) get() ([]byte, *Indexer) {
+	if l == nil {
+		return nil, nil
+	}
+	return l.key, l.value
+}
+
+// 子树中第一个大于等于key的键, key为相对子树的剩余部分
+func (n *artNode) seek(key []byte) *artLeaf {
+	l := len(n.prefix)
+	if len(key) < l {
+		l = len(key)
+	}
+	switch c := bytes.Compare(n.prefix[:l], key[:l]); {
+	case c > 0:
+		return n.minimum()
+	case c < 0:
+		return nil
+	}
+	// key是前缀的前缀, 子树中所有的键都不小于key
+	if len(key) <= len(n.prefix) {
+		return n.minimum()
+	}
+
+	// 在该节点结束的键比key短, 小于key
+	key = key[len(n.prefix):]
+	if child := n.child(key[0]); child != nil {
+		if leaf := child.seek(key[1:]); leaf != nil {
+			return leaf
+		}
+	}
+	if _, child := n.next(int(key[0])); child != nil {
+		return child.minimum()
+	}
+	return nil
+}
+
+// 子树中最后一个小于key的键, key为相对子树的剩余部分
+func (n *artNode) seekBefore(key []byte) *artLeaf {
+	l := len(n.prefix)
+	if len(key) < l {
+		l = len(key)
+	}
+	switch c := bytes.Compare(n.prefix[:l], key[:l]); {
+	case c < 0:
+		return n.maximum()
+	case c > 0:
+		return nil
+	}
+	if len(key) <= len(n.prefix) {
+		return nil
+	}
+
+	key = key[len(n.prefix):]
+	if child := n.child(key[0]); child != nil {
+		if leaf := child.seekBefore(key[1:]); leaf != nil {
+			return leaf
+		}
+	}
+	if _, child := n.prev(int(key[0])); child != nil {
+		return child.maximum()
+	}
+	return n.leaf
+}
+
+// 子树中最小的键
+func (n *artNode) minimum() *artLeaf {
+	for n.leaf == nil {
+		_, n = n.next(-1)
+	}
+	return n.leaf
+}
+
+// 子树中最大的键
+func (n *artNode) maximum() *artLeaf {
+	for n.size > 0 {
+		_, n = n.prev(256)
+	}
+	return n.leaf
+}
+
+// 查找字节对应的子节点
+func (n *artNode) child(c byte) *artNode {
+	if ref := n.childRef(c); ref != nil {
+		return *ref
+	}
+	return nil
+}
+
+// 返回字节对应的子节点所在位置, 子节点不存在时返回空
+func (n *artNode) childRef(c byte) **artNode {
+	switch n.kind {
+	case node4, node16:
+		for i := 0; i < n.size; i++ {
+			if n.keys[i] == c {
+				return &n.children[i]
+			}
+		}
+	case node48:
+		if pos := n.keys[c]; pos != 0 {
+			return &n.children[pos-1]
+		}
+	case node256:
+		if n.children[c] != nil {
+			return &n.children[c]
+		}
+	}
+	return nil
+}
+
+// 字节大于c的第一个子节点
+func (n *artNode) next(c int) (byte, *artNode) {
+	switch n.kind {
+	case node4, node16:
+		for i := 0; i < n.size; i++ {
+			if int(n.keys[i]) > c {
+				return n.keys[i], n.children[i]
+			}
+		}
+	case node48:
+		for b := c + 1; b < 256; b++ {
+			if pos := n.keys[b]; pos != 0 {
+				return byte(b), n.children[pos-1]
+			}
+		}
+	case node256:
+		for b := c + 1; b < 256; b++ {
+			if n.children[b] != nil {
+				return byte(b), n.children[b]
+			}
+		}
+	}
+	return 0, nil
+}
+
+// 字节小于c的最后一个子节点
+func (n *artNode) prev(c int) (byte, *artNode) {
+	switch n.kind {
+	case node4, node16:
+		for i := n.size - 1; i >= 0; i-- {
+			if int(n.keys[i]) < c {
+				return n.keys[i], n.children[i]
+			}
+		}
+	case node48:
+		for b := c - 1; b >= 0; b-- {
+			if pos := n.keys[b]; pos != 0 {
+				return byte(b), n.children[pos-1]
+			}
+		}
+	case node256:
+		for b := c - 1; b >= 0; b-- {
+			if n.children[b] != nil {
+				return byte(b), n.children[b]
+			}
+		}
+	}
+	return 0, nil
+}
+
+// 添加子节点, 节点已满时扩容
+func (n *artNode) addChild(c byte, child *artNode) {
+	if n.size == nodeCapacity[n.kind] {
+		n.resize(n.kind + 1)
+	}
+
+	switch n.kind {
+	case node4, node16:
+		i := 0
+		for i < n.size && n.keys[i] < c {
+			i++
+		}
+		copy(n.keys[i+1:n.size+1], n.keys[i:n.size])
+		copy(n.children[i+1:n.size+1], n.children[i:n.size])
+		n.keys[i], n.children[i] = c, child
+	case node48:
+		pos := 0
+		for n.children[pos] != nil {
+			pos++
+		}
+		n.children[pos] = child
+		n.keys[c] = byte(pos + 1)
+	case node256:
+		n.children[c] = child
+	}
+	n.size++
+}
+
+// 删除子节点, 子节点数量过少时缩容
+func (n *artNode) removeChild(c byte) {
+	switch n.kind {
+	case node4, node16:
+		i := 0
+		for n.keys[i] != c {
+			i++
+		}
+		copy(n.keys[i:], n.keys[i+1:n.size])
+		copy(n.children[i:], n.children[i+1:n.size])
+		n.children[n.size-1] = nil
+	case node48:
+		n.children[n.keys[c]-1] = nil
+		n.keys[c] = 0
+	case node256:
+		n.children[c] = nil
+	}
+	n.size--
+
+	// 留出余量, 避免在临界点反复扩容缩容
+	if n.kind > node4 && n.size < nodeCapacity[n.kind-1]*3/4 {
+		n.resize(n.kind - 1)
+	}
+}
+
+// 转换为其他类型的节点, 子节点保持不变
+func (n *artNode) resize(kind uint8) {
+	keys := make([]byte, 0, n.size)
+	children := make([]*artNode, 0, n.size)
+	for c, child := n.next(-1); child != nil; c, child = n.next(int(c)) {
+		keys = append(keys, c)
+		children = append(children, child)
+	}
+
+	n.kind = kind
+	n.keys, n.children = nil, make([]*artNode, nodeCapacity[kind])
+	switch kind {
+	case node4, node16:
+		n.keys = make([]byte, nodeCapacity[kind])
+		copy(n.keys, keys)
+		copy(n.children, children)
+	case node48:
+		n.keys = make([]byte, 256)
+		for i, c := range keys {
+			n.keys[c] = byte(i + 1)
+			n.children[i] = children[i]
+		}
+	case node256:
+		for i, c := range keys {
+			n.children[c] = children[i]
+		}
+	}
+}
+
+// 公共前缀的长度
+func commonPrefix(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,905 @@
+package index
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"kvstore/store"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	// PageSize B+树文件的页大小
+	PageSize = 4096
+
+	// MaxBPTreeKeySize B+树能保存的键的最大长度, 保证每页至少能放下两个元素
+	MaxBPTreeKeySize = 1024
+
+	// 页头部: 类型(1) 保留(1) 元素数量(2) 校验和(4)
+	pageHeaderSize = 8
+	// 叶子节点的值: 文件id(4) entry大小(4) 偏移(8)
+	leafValueSize = 16
+	// 元素数量低于该大小时与兄弟节点合并或重新分配
+	minFillSize = PageSize / 4
+
+	bpMagic   = "KVBP"
+	bpVersion = 1
+	// 日志文件: 魔数(4) 页数量(4), 之后每页为页号(4)和页内容, 最后是校验和(4)
+	journalMagic  = "KVBJ"
+	journalSuffix = ".journal"
+)
+
+// 页的类型
+const (
+	pageMeta uint8 = iota
+	pageLeaf
+	pageInternal
+	pageFree
+)
+
+var (
+	// ErrBPTreeCorrupted B+树文件损坏
+	ErrBPTreeCorrupted = errors.New("b+tree file is corrupted")
+)
+
+type (
+	// BPTree 保存在磁盘上的B+树字符串索引表, 只保存键和entry的位置
+	// 页按需读入容量有限的缓存, 修改过的页在提交之前不会被淘汰;
+	// 提交时先将修改过的页完整写入日志文件, 再覆盖原来的页, 中途崩溃时打开文件会根据日志恢复
+	BPTree struct {
+		mu   sync.Mutex
+		file *os.File
+		path string
+		meta bpMeta
+
+		// 缓存的页, 修改过的页不在lru中
+		nodes    map[uint32]*bpNode
+		lru      *list.List
+		dirty    map[uint32]*bpNode
+		capacity int
+		// 元信息是否被修改
+		metaDirty bool
+
+		// 读写文件时发生的错误, 发生错误之后的修改不再提交
+		err error
+	}
+
+	// Checkpoint 数据文件中的位置, 该位置之前的写入都已经包含在提交的B+树中
+	Checkpoint struct {
+		FileId uint32
+		Offset int64
+	}
+
+	bpMeta struct {
+		root  uint32
+		pages uint32
+		// 空闲页链表的头部, 为0表示没有空闲页
+		free  uint32
+		count uint64
+		// 检查点是否有效
+		valid      bool
+		checkpoint Checkpoint
+	}
+
+	// 解码后的页
+	bpNode struct {
+		id   uint32
+		kind uint8
+		keys [][]byte
+		// 叶子节点的值
+		vals []bpValue
+		// 内部节点的子节点, 比keys多一个, 第i个子节点中的键在[keys[i-1], keys[i])之间
+		children []uint32
+		// 空闲页指向下一个空闲页
+		next uint32
+
+		elem *list.Element
+	}
+
+	bpValue struct {
+		fileId    uint32
+		entrySize uint32
+		offset    int64
+	}
+)
+
+// OpenBPTree 打开B+树文件, 文件不存在时新建, 元信息损坏时清空重建
+// cachePages为缓存的页数量上限
+func OpenBPTree(path string, cachePages int) (*BPTree, error) {
+	if cachePages < 16 {
+		cachePages = 16
+	}
+	if err := recoverJournal(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, store.FilePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &BPTree{file: f, path: path, capacity: cachePages}
+	t.resetCache()
+	if err := t.readMeta(); err != nil {
+		if err != ErrBPTreeCorrupted {
+			_ = f.Close()
+			return nil, err
+		}
+		log.Printf("%s, rebuild it\n", err.Error())
+		if err := t.Reset(); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Get 查询键的索引信息
+func (t *BPTree) Get(key []byte) *Indexer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.shrink()
+
+	n := t.node(t.meta.root)
+	for n != nil && n.kind == pageInternal {
+		n = t.node(n.children[n.childIndex(key)])
+	}
+	if n == nil {
+		return nil
+	}
+	if i, found := n.search(key); found {
+		return n.indexer(i)
+	}
+	return nil
+}
+
+// Put 插入或更新键的索引信息, 返回旧的索引信息
+func (t *BPTree) Put(key []byte, idx *Indexer) *Indexer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.shrink()
+
+	root := t.node(t.meta.root)
+	if root == nil {
+		return nil
+	}
+	v := bpValue{fileId: idx.FileId, entrySize: idx.EntrySize, offset: idx.Offset}
+	old, sep, right := t.insert(root, append([]byte(nil), key...), v)
+
+	// 根节点分裂时树高加一
+	if right != nil {
+		n := t.alloc(pageInternal)
+		n.keys = [][]byte{sep}
+		n.children = []uint32{root.id, right.id}
+		t.meta.root = n.id
+		t.metaDirty = true
+	}
+	if old == nil {
+		t.meta.count++
+		t.metaDirty = true
+	}
+	return old
+}
+
+// Delete 删除键, 返回被删除的索引信息
+func (t *BPTree) Delete(key []byte) *Indexer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.shrink()
+
+	root := t.node(t.meta.root)
+	if root == nil {
+		return nil
+	}
+	old := t.remove(root, key)
+	if old == nil {
+		return nil
+	}
+
+	// 根节点只剩一个子节点时树高减一
+	if root.kind == pageInternal && len(root.keys) == 0 {
+		t.meta.root = root.children[0]
+		t.release(root)
+	}
+	t.meta.count--
+	t.metaDirty = true
+	return old
+}
+
+// Iterator 返回按键的字节序遍历的迭代器
+func (t *BPTree) Iterator() Iterator {
+	return &iterator{s: t}
+}
+
+// Len 返回键的数量
+func (t *BPTree) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return int(t.meta.count)
+}
+
+// Checkpoint 返回上次提交时的检查点
+func (t *BPTree) Checkpoint() (Checkpoint, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.meta.checkpoint, t.meta.valid
+}
+
+// NeedCommit 判断修改过的页是否已经占用了一半的缓存
+func (t *BPTree) NeedCommit() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.dirty) >= t.capacity/2
+}
+
+// Commit 提交所有修改过的页, 并记录检查点
+func (t *BPTree) Commit(cp Checkpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.meta.valid, t.meta.checkpoint = true, cp
+	t.metaDirty = true
+	return t.commit()
+}
+
+// Invalidate 提交所有修改过的页, 并使检查点失效, 之后打开时需要重建
+func (t *BPTree) Invalidate() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.meta.valid, t.meta.checkpoint = false, Checkpoint{}
+	t.metaDirty = true
+	return t.commit()
+}
+
+// Reset 清空B+树
+func (t *BPTree) Reset() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.file.Truncate(0); err != nil {
+		return err
+	}
+	t.err = nil
+	t.resetCache()
+	t.meta = bpMeta{pages: 1}
+	t.meta.root = t.alloc(pageLeaf).id
+	t.metaDirty = true
+	return t.commit()
+}
+
+// Close 关闭文件, 未提交的修改被丢弃
+func (t *BPTree) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
+
+// 在子树中插入, 子节点分裂时返回分隔键和新的右侧节点
+func (t *BPTree) insert(n *bpNode, key []byte, v bpValue) (*Indexer, []byte, *bpNode) {
+	var old *Indexer
+	if n.kind == pageLeaf {
+		i, found := n.search(key)
+		if found {
+			old = n.indexer(i)
+			n.vals[i] = v
+			t.markDirty(n)
+			return old, nil, nil
+		}
+		n.keys = append(n.keys, nil)
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = key
+		n.vals = append(n.vals, bpValue{})
+		copy(n.vals[i+1:], n.vals[i:])
+		n.vals[i] = v
+	} else {
+		i := n.childIndex(key)
+		child := t.node(n.children[i])
+		if child == nil {
+			return nil, nil, nil
+		}
+		var sep []byte
+		var right *bpNode
+		if old, sep, right = t.insert(child, key, v); right == nil {
+			return old, nil, nil
+		}
+		n.keys = append(n.keys, nil)
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = sep
+		n.children = append(n.children, 0)
+		copy(n.children[i+2:], n.children[i+1:])
+		n.children[i+1] = right.id
+	}
+	t.markDirty(n)
+
+	if n.size() <= PageSize {
+		return old, nil, nil
+	}
+	right := t.alloc(n.kind)
+	sep := t.split(n, right)
+	return old, sep, right
+}
+
+// 将节点后半部分的元素移到right中, 返回分隔键
+func (t *BPTree) split(n, right *bpNode) []byte {
+	m := n.splitIndex()
+	var sep []byte
+	if n.kind == pageLeaf {
+		right.keys = append([][]byte(nil), n.keys[m:]...)
+		right.vals = append([]bpValue(nil), n.vals[m:]...)
+		n.keys, n.vals = n.keys[:m:m], n.vals[:m:m]
+		sep = right.keys[0]
+	} else {
+		sep = n.keys[m]
+		right.keys = append([][]byte(nil), n.keys[m+1:]...)
+		right.children = append([]uint32(nil), n.children[m+1:]...)
+		n.keys, n.children = n.keys[:m:m], n.children[:m+1:m+1]
+	}
+	t.markDirty(n)
+	t.markDirty(right)
+	return sep
+}
+
+// 从子树中删除, 子节点过小时与兄弟节点合并或重新分配
+func (t *BPTree) remove(n *bpNode, key []byte) *Indexer {
+	if n.kind == pageLeaf {
+		i, found := n.search(key)
+		if !found {
+			return nil
+		}
+		old := n.indexer(i)
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		n.vals = append(n.vals[:i], n.vals[i+1:]...)
+		t.markDirty(n)
+		return old
+	}
+
+	i := n.childIndex(key)
+	child := t.node(n.children[i])
+	if child == nil {
+		return nil
+	}
+	old := t.remove(child, key)
+	if old != nil && child.size() < minFillSize {
+		t.rebalance(n, i)
+	}
+	return old
+}
+
+// 第i个子节点过小, 与相邻的兄弟节点合并, 放不下一页时重新平均分配
+func (t *BPTree) rebalance(n *bpNode, i int) {
+	if len(n.children) < 2 {
+		return
+	}
+	if i == len(n.children)-1 {
+		i--
+	}
+	left, right := t.node(n.children[i]), t.node(n.children[i+1])
+	if left == nil || right == nil {
+		return
+	}
+
+	// 合并到左侧节点
+	if left.kind == pageLeaf {
+		left.keys = append(left.keys, right.keys...)
+		left.vals = append(left.vals, right.vals...)
+	} else {
+		left.keys = append(append(left.keys, n.keys[i]), right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+	t.markDirty(left)
+	t.markDirty(n)
+
+	if left.size() <= PageSize {
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		n.children = append(n.children[:i+1], n.children[i+2:]...)
+		t.release(right)
+		return
+	}
+	right.keys, right.vals, right.children = nil, nil, nil
+	n.keys[i] = t.split(left, right)
+}
+
+// 读取页, 失败时记录错误并返回空
+func (t *BPTree) node(id uint32) *bpNode {
+	if n, exist := t.nodes[id]; exist {
+		if n.elem != nil {
+			t.lru.MoveToFront(n.elem)
+		}
+		return n
+	}
+	if t.err != nil {
+		return nil
+	}
+
+	buf := make([]byte, PageSize)
+	if _, err := t.file.ReadAt(buf, int64(id)*PageSize); err != nil {
+		t.fail(err)
+		return nil
+	}
+	n, err := decodeNode(id, buf)
+	if err != nil {
+		t.fail(err)
+		return nil
+	}
+	t.nodes[id] = n
+	n.elem = t.lru.PushFront(n)
+	return n
+}
+
+// 分配新页, 优先使用空闲页
+func (t *BPTree) alloc(kind uint8) *bpNode {
+	id := t.meta.pages
+	if t.meta.free != 0 {
+		if free := t.node(t.meta.free); free != nil && free.kind == pageFree {
+			id, t.meta.free = free.id, free.next
+			t.evict(free)
+		} else {
+			t.meta.free = 0
+		}
+	}
+	if id == t.meta.pages {
+		t.meta.pages++
+	}
+	t.metaDirty = true
+
+	n := &bpNode{id: id, kind: kind}
+	t.nodes[id] = n
+	t.markDirty(n)
+	return n
+}
+
+// 释放页, 加入空闲页链表
+func (t *BPTree) release(n *bpNode) {
+	n.kind, n.keys, n.vals, n.children = pageFree, nil, nil, nil
+	n.next, t.meta.free = t.meta.free, n.id
+	t.metaDirty = true
+	t.markDirty(n)
+}
+
+func (t *BPTree) markDirty(n *bpNode) {
+	if n.elem != nil {
+		t.lru.Remove(n.elem)
+		n.elem = nil
+	}
+	t.dirty[n.id] = n
+}
+
+func (t *BPTree) evict(n *bpNode) {
+	if n.elem != nil {
+		t.lru.Remove(n.elem)
+		n.elem = nil
+	}
+	delete(t.nodes, n.id)
+	delete(t.dirty, n.id)
+}
+
+// 淘汰最久未使用的页, 直到缓存的页数量不超过上限, 修改过的页不会被淘汰
+func (t *BPTree) shrink() {
+	for len(t.nodes) > t.capacity && t.lru.Len() > 0 {
+		t.evict(t.lru.Back().Value.(*bpNode))
+	}
+}
+
+func (t *BPTree) resetCache() {
+	t.nodes = make(map[uint32]*bpNode)
+	t.dirty = make(map[uint32]*bpNode)
+	t.lru = list.New()
+}
+
+func (t *BPTree) fail(err error) {
+	if t.err == nil {
+		log.Printf("b+tree %s : %s\n", t.path, err.Error())
+		t.err = err
+	}
+}
+
+// 先将修改过的页写入日志文件, 再覆盖原来的页, 最后删除日志文件
+func (t *BPTree) commit() error {
+	if t.err != nil {
+		return t.err
+	}
+	if len(t.dirty) == 0 && !t.metaDirty {
+		return nil
+	}
+
+	ids := make([]uint32, 0, len(t.dirty)+1)
+	pages := make(map[uint32][]byte, len(t.dirty)+1)
+	for id, n := range t.dirty {
+		ids = append(ids, id)
+		pages[id] = n.encode()
+	}
+	ids = append(ids, 0)
+	pages[0] = t.meta.encode()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	if err := writeJournal(t.path+journalSuffix, ids, pages); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := t.file.WriteAt(pages[id], int64(id)*PageSize); err != nil {
+			t.fail(err)
+			return err
+		}
+	}
+	if err := t.file.Sync(); err != nil {
+		t.fail(err)
+		return err
+	}
+	if err := os.Remove(t.path + journalSuffix); err != nil {
+		return err
+	}
+
+	// 提交后的页可以被淘汰
+	for _, n := range t.dirty {
+		if n.kind == pageFree {
+			delete(t.nodes, n.id)
+			continue
+		}
+		n.elem = t.lru.PushFront(n)
+	}
+	t.dirty = make(map[uint32]*bpNode)
+	t.metaDirty = false
+	t.shrink()
+	return nil
+}
+
+// 读取元信息页, 新建的文件写入初始的元信息
+func (t *BPTree) readMeta() error {
+	info, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return t.Reset()
+	}
+
+	buf := make([]byte, PageSize)
+	if _, err := t.file.ReadAt(buf, 0); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrBPTreeCorrupted
+		}
+		return err
+	}
+	return t.meta.decode(buf)
+}
+
+// 在子树中查找第一个大于等于key的键, 当前叶子节点中没有时到右侧最近的子树中查找
+func (t *BPTree) seek(key []byte) ([]byte, *Indexer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.shrink()
+
+	var right uint32
+	n := t.node(t.meta.root)
+	for n != nil && n.kind == pageInternal {
+		i := n.childIndex(key)
+		if i < len(n.children)-1 {
+			right = n.children[i+1]
+		}
+		n = t.node(n.children[i])
+	}
+	if n == nil {
+		return nil, nil
+	}
+	if i := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) >= 0 }); i < len(n.keys) {
+		return n.keys[i], n.indexer(i)
+	}
+	if right == 0 {
+		return nil, nil
+	}
+	for n = t.node(right); n != nil && n.kind == pageInternal; n = t.node(n.children[0]) {
+	}
+	if n == nil || len(n.keys) == 0 {
+		return nil, nil
+	}
+	return n.keys[0], n.indexer(0)
+}
+
+// 在子树中查找最后一个小于key的键, 当前叶子节点中没有时到左侧最近的子树中查找
+func (t *BPTree) seekBefore(key []byte) ([]byte, *Indexer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.shrink()
+
+	// 第一个大于等于key的位置, key为空时为末尾
+	position := func(keys [][]byte) int {
+		if key == nil {
+			return len(keys)
+		}
+		return sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], key) >= 0 })
+	}
+
+	var left uint32
+	n := t.node(t.meta.root)
+	for n != nil && n.kind == pageInternal {
+		i := position(n.keys)
+		if i > 0 {
+			left = n.children[i-1]
+		}
+		n = t.node(n.children[i])
+	}
+	if n == nil {
+		return nil, nil
+	}
+	if i := position(n.keys); i > 0 {
+		return n.keys[i-1], n.indexer(i - 1)
+	}
+	if left == 0 {
+		return nil, nil
+	}
+	for n = t.node(left); n != nil && n.kind == pageInternal; n = t.node(n.children[len(n.children)-1]) {
+	}
+	if n == nil || len(n.keys) == 0 {
+		return nil, nil
+	}
+	last := len(n.keys) - 1
+	return n.keys[last], n.indexer(last)
+}
+
+// 查找叶子节点中键的位置
+func (n *bpNode) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) >= 0 })
+	return i, i < len(n.keys) && bytes.Equal(n.keys[i], key)
+}
+
+// 内部节点中键所在的子节点位置
+func (n *bpNode) childIndex(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) > 0 })
+}
+
+func (n *bpNode) indexer(i int) *Indexer {
+	key := append([]byte(nil), n.keys[i]...)
+	v := n.vals[i]
+	return &Indexer{
+		Meta:      &store.Meta{Key: key, KeySize: uint32(len(key))},
+		FileId:    v.fileId,
+		EntrySize: v.entrySize,
+		Offset:    v.offset,
+	}
+}
+
+// 编码后的大小
+func (n *bpNode) size() int {
+	size := pageHeaderSize
+	if n.kind == pageInternal {
+		size += 4 * len(n.children)
+	}
+	for _, key := range n.keys {
+		size += 2 + len(key)
+		if n.kind == pageLeaf {
+			size += leafValueSize
+		}
+	}
+	return size
+}
+
+// 分裂的位置, 使两侧编码后的大小尽量接近
+func (n *bpNode) splitIndex() int {
+	half, size := n.size()/2, pageHeaderSize
+	for i, key := range n.keys {
+		size += 2 + len(key) + 4
+		if n.kind == pageLeaf {
+			size += leafValueSize - 4
+		}
+		if size >= half {
+			if i == 0 {
+				return 1
+			}
+			if n.kind == pageLeaf || i < len(n.keys)-1 {
+				return i
+			}
+			return i - 1
+		}
+	}
+	return len(n.keys) / 2
+}
+
+func (n *bpNode) encode() []byte {
+	buf := make([]byte, PageSize)
+	buf[0] = n.kind
+	binary.BigEndian.PutUint16(buf[2:4], uint16(len(n.keys)))
+
+	p := pageHeaderSize
+	switch n.kind {
+	case pageFree:
+		binary.BigEndian.PutUint32(buf[p:], n.next)
+	case pageLeaf:
+		for i, key := range n.keys {
+			binary.BigEndian.PutUint16(buf[p:], uint16(len(key)))
+			p += 2 + copy(buf[p+2:], key)
+			v := n.vals[i]
+			binary.BigEndian.PutUint32(buf[p:], v.fileId)
+			binary.BigEndian.PutUint32(buf[p+4:], v.entrySize)
+			binary.BigEndian.PutUint64(buf[p+8:], uint64(v.offset))
+			p += leafValueSize
+		}
+	case pageInternal:
+		binary.BigEndian.PutUint32(buf[p:], n.children[0])
+		p += 4
+		for i, key := range n.keys {
+			binary.BigEndian.PutUint16(buf[p:], uint16(len(key)))
+			p += 2 + copy(buf[p+2:], key)
+			binary.BigEndian.PutUint32(buf[p:], n.children[i+1])
+			p += 4
+		}
+	}
+	binary.BigEndian.PutUint32(buf[4:8], pageChecksum(buf))
+	return buf
+}
+
+func decodeNode(id uint32, buf []byte) (*bpNode, error) {
+	if binary.BigEndian.Uint32(buf[4:8]) != pageChecksum(buf) {
+		return nil, ErrBPTreeCorrupted
+	}
+	n := &bpNode{id: id, kind: buf[0]}
+	count := int(binary.BigEndian.Uint16(buf[2:4]))
+
+	// 读取键, 越界说明页已经损坏
+	p := pageHeaderSize
+	readKey := func() ([]byte, bool) {
+		if p+2 > PageSize {
+			return nil, false
+		}
+		size := int(binary.BigEndian.Uint16(buf[p:]))
+		if p+2+size > PageSize {
+			return nil, false
+		}
+		key := append([]byte(nil), buf[p+2:p+2+size]...)
+		p += 2 + size
+		return key, true
+	}
+
+	switch n.kind {
+	case pageFree:
+		n.next = binary.BigEndian.Uint32(buf[p:])
+	case pageLeaf:
+		for i := 0; i < count; i++ {
+			key, ok := readKey()
+			if !ok || p+leafValueSize > PageSize {
+				return nil, ErrBPTreeCorrupted
+			}
+			n.keys = append(n.keys, key)
+			n.vals = append(n.vals, bpValue{
+				fileId:    binary.BigEndian.Uint32(buf[p:]),
+				entrySize: binary.BigEndian.Uint32(buf[p+4:]),
+				offset:    int64(binary.BigEndian.Uint64(buf[p+8:])),
+			})
+			p += leafValueSize
+		}
+	case pageInternal:
+		n.children = append(n.children, binary.BigEndian.Uint32(buf[p:]))
+		p += 4
+		for i := 0; i < count; i++ {
+			key, ok := readKey()
+			if !ok || p+4 > PageSize {
+				return nil, ErrBPTreeCorrupted
+			}
+			n.keys = append(n.keys, key)
+			n.children = append(n.children, binary.BigEndian.Uint32(buf[p:]))
+			p += 4
+		}
+	default:
+		return nil, ErrBPTreeCorrupted
+	}
+	return n, nil
+}
+
+// 元信息页: 魔数(4) 版本(2) 根节点(4) 页数量(4) 空闲页(4) 键数量(8) 检查点是否有效(1) 检查点(12) 校验和(4)
+func (m *bpMeta) encode() []byte {
+	buf := make([]byte, PageSize)
+	copy(buf, bpMagic)
+	binary.BigEndian.PutUint16(buf[4:], bpVersion)
+	binary.BigEndian.PutUint32(buf[6:], m.root)
+	binary.BigEndian.PutUint32(buf[10:], m.pages)
+	binary.BigEndian.PutUint32(buf[14:], m.free)
+	binary.BigEndian.PutUint64(buf[18:], m.count)
+	if m.valid {
+		buf[26] = 1
+	}
+	binary.BigEndian.PutUint32(buf[27:], m.checkpoint.FileId)
+	binary.BigEndian.PutUint64(buf[31:], uint64(m.checkpoint.Offset))
+	binary.BigEndian.PutUint32(buf[39:], crc32.ChecksumIEEE(buf[:39]))
+	return buf
+}
+
+func (m *bpMeta) decode(buf []byte) error {
+	if string(buf[:4]) != bpMagic || binary.BigEndian.Uint16(buf[4:]) != bpVersion ||
+		binary.BigEndian.Uint32(buf[39:]) != crc32.ChecksumIEEE(buf[:39]) {
+		return ErrBPTreeCorrupted
+	}
+	m.root = binary.BigEndian.Uint32(buf[6:])
+	m.pages = binary.BigEndian.Uint32(buf[10:])
+	m.free = binary.BigEndian.Uint32(buf[14:])
+	m.count = binary.BigEndian.Uint64(buf[18:])
+	m.valid = buf[26] == 1
+	m.checkpoint.FileId = binary.BigEndian.Uint32(buf[27:])
+	m.checkpoint.Offset = int64(binary.BigEndian.Uint64(buf[31:]))
+	if m.root == 0 || m.root >= m.pages {
+		return ErrBPTreeCorrupted
+	}
+	return nil
+}
+
+// 页的校验和, 不包括校验和本身
+func pageChecksum(buf []byte) uint32 {
+	crc := crc32.ChecksumIEEE(buf[:4])
+	return crc32.Update(crc, crc32.IEEETable, buf[8:])
+}
+
+// 将要覆盖的页写入日志文件并同步到磁盘
+func writeJournal(path string, ids []uint32, pages map[uint32][]byte) error {
+	buf := make([]byte, 0, 8+len(ids)*(4+PageSize)+4)
+	buf = append(buf, journalMagic...)
+	buf = appendUint32(buf, uint32(len(ids)))
+	for _, id := range ids {
+		buf = appendUint32(buf, id)
+		buf = append(buf, pages[id]...)
+	}
+	buf = appendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, store.FilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 打开文件前检查日志文件, 完整的日志说明上次提交覆盖页时中断, 重新写入; 不完整的日志直接删除
+func recoverJournal(path string) error {
+	buf, err := ioutil.ReadFile(path + journalSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	valid := len(buf) >= 12 && string(buf[:4]) == journalMagic
+	if valid {
+		count := int(binary.BigEndian.Uint32(buf[4:8]))
+		end := 8 + count*(4+PageSize)
+		valid = len(buf) == end+4 && binary.BigEndian.Uint32(buf[end:]) == crc32.ChecksumIEEE(buf[:end])
+	}
+	if valid {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, store.FilePerm)
+		if err != nil {
+			return err
+		}
+		for p := 8; p < len(buf)-4; p += 4 + PageSize {
+			id := binary.BigEndian.Uint32(buf[p:])
+			if _, err := f.WriteAt(buf[p+4:p+4+PageSize], int64(id)*PageSize); err != nil {
+				_ = f.Close()
+				return err
+			}
+		}
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return os.Remove(path + journalSuffix)
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return append(buf, b[:]...)
+}
@@ -0,0 +1,287 @@
+package index
+
+import (
+	"bytes"
+	"sort"
+)
+
+// B树的最小度数, 除根节点外每个节点有[degree-1, 2*degree-1]个元素
+const degree = 32
+
+type (
+	// BTree 基于内存B树的字符串索引表
+	BTree struct {
+		root *bnode
+		size int
+	}
+
+	// B树节点, 叶子节点没有子节点
+	bnode struct {
+		items    []bitem
+		children []*bnode
+	}
+
+	bitem struct {
+		key   []byte
+		value *Indexer
+	}
+)
+
+// NewBTree 建立基于B树的字符串索引表
+func NewBTree() *BTree {
+	return &BTree{root: &bnode{}}
+}
+
+// Get 查询键的索引信息
+func (t *BTree) Get(key []byte) *Indexer {
+	n := t.root
+	for {
+		i, found := n.search(key)
+		if found {
+			return n.items[i].value
+		}
+		if n.leaf() {
+			return nil
+		}
+		n = n.children[i]
+	}
+}
+
+// Put 插入或更新键的索引信息, 返回旧的索引信息
+func (t *BTree) Put(key []byte, idx *Indexer) *Indexer {
+	// 根节点已满时先分裂, 树高加一
+	if len(t.root.items) == 2*degree-1 {
+		old := t.root
+		t.root = &bnode{children: []*bnode{old}}
+		t.root.split(0)
+	}
+
+	n := t.root
+	for {
+		i, found := n.search(key)
+		if found {
+			old := n.items[i].value
+			n.items[i].value = idx
+			return old
+		}
+		if n.leaf() {
+			n.items = append(n.items, bitem{})
+			copy(n.items[i+1:], n.items[i:])
+			n.items[i] = bitem{key: key, value: idx}
+			t.size++
+			return nil
+		}
+		// 下降之前保证子节点未满, 分裂时不需要回溯
+		if len(n.children[i].items) == 2*degree-1 {
+			n.split(i)
+			switch c := bytes.Compare(key, n.items[i].key); {
+			case c == 0:
+				old := n.items[i].value
+				n.items[i].value = idx
+				return old
+			case c > 0:
+				i++
+			}
+		}
+		n = n.children[i]
+	}
+}
+
+// Delete 删除键, 返回被删除的索引信息
+func (t *BTree) Delete(key []byte) *Indexer {
+	item, found := t.root.remove(key)
+	// 根节点的元素被合并到子节点后, 树高减一
+	if len(t.root.items) == 0 && !t.root.leaf() {
+		t.root = t.root.children[0]
+	}
+	if !found {
+		return nil
+	}
+	t.size--
+	return item.value
+}
+
+// Iterator 返回按键的字节序遍历的迭代器
+func (t *BTree) Iterator() Iterator {
+	return &iterator{s: t}
+}
+
+// Len 返回键的数量
+func (t *BTree) Len() int {
+	return t.size
+}
+
+func (t *BTree) seek(key []byte) ([]byte, *Indexer) {
+	var res *bitem
+	for n := t.root; n != nil; {
+		i, found := n.search(key)
+		if i < len(n.items) {
+			res = &n.items[i]
+			if found {
+				break
+			}
+		}
+		if n.leaf() {
+			break
+		}
+		n = n.children[i]
+	}
+	return res.get()
+}
+
+func (t *BTree) seekBefore(key []byte) ([]byte, *Indexer) {
+	var res *bitem
+	for n := t.root; n != nil; {
+		i := len(n.items)
+		if key != nil {
+			i, _ = n.search(key)
+		}
+		if i > 0 {
+			res = &n.items[i-1]
+		}
+		if n.leaf() {
+			break
+		}
+		n = n.children[i]
+	}
+	return res.get()
+}
+
+func (item *bitem) get() ([]byte, *Indexer) {
+	if item == nil {
+		return nil, nil
+	}
+	return item.key, item.value
+}
+
+func (n *bnode) leaf() bool {
+	return len(n.children) == 0
+}
+
+// 查找第一个大于等于key的元素位置
+func (n *bnode) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return bytes.Compare(n.items[i].key, key) >= 0
+	})
+	return i, i < len(n.items) && bytes.Equal(n.items[i].key, key)
+}
+
+// 分裂已满的第i个子节点, 中间的元素上移到当前节点
+func (n *bnode) split(i int) {
+	child := n.children[i]
+	mid := child.items[degree-1]
+
+	right := &bnode{items: append([]bitem(nil), child.items[degree:]...)}
+	if !child.leaf() {
+		right.children = append([]*bnode(nil), child.children[degree:]...)
+		child.children = child.children[:degree:degree]
+	}
+	child.items = child.items[: degree-1 : degree-1]
+
+	n.items = append(n.items, bitem{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = mid
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = right
+}
+
+// 从子树中删除键, 下降之前保证子节点至少有degree个元素, 删除时不需要回溯
+func (n *bnode) remove(key []byte) (bitem, bool) {
+	i, found := n.search(key)
+	if n.leaf() {
+		if !found {
+			return bitem{}, false
+		}
+		item := n.items[i]
+		n.items = append(n.items[:i], n.items[i+1:]...)
+		return item, true
+	}
+
+	if found {
+		item := n.items[i]
+		switch {
+		case len(n.children[i].items) >= degree:
+			// 用前驱替换后从左子树删除前驱
+			pred := n.children[i].max()
+			n.items[i] = pred
+			n.children[i].remove(pred.key)
+		case len(n.children[i+1].items) >= degree:
+			// 用后继替换后从右子树删除后继
+			succ := n.children[i+1].min()
+			n.items[i] = succ
+			n.children[i+1].remove(succ.key)
+		default:
+			// 左右子节点都只有degree-1个元素, 合并后从中删除
+			n.merge(i)
+			n.children[i].remove(key)
+		}
+		return item, true
+	}
+
+	if len(n.children[i].items) == degree-1 {
+		i = n.fill(i)
+	}
+	return n.children[i].remove(key)
+}
+
+// 第i个子节点只有degree-1个元素时, 从兄弟节点借一个元素或与兄弟节点合并, 返回键所在的子节点位置
+func (n *bnode) fill(i int) int {
+	switch {
+	case i > 0 && len(n.children[i-1].items) >= degree:
+		// 从左兄弟借
+		child, left := n.children[i], n.children[i-1]
+		child.items = append(child.items, bitem{})
+		copy(child.items[1:], child.items)
+		child.items[0] = n.items[i-1]
+		n.items[i-1] = left.items[len(left.items)-1]
+		left.items = left.items[:len(left.items)-1]
+		if !left.leaf() {
+			child.children = append(child.children, nil)
+			copy(child.children[1:], child.children)
+			child.children[0] = left.children[len(left.children)-1]
+			left.children = left.children[:len(left.children)-1]
+		}
+	case i < len(n.children)-1 && len(n.children[i+1].items) >= degree:
+		// 从右兄弟借
+		child, right := n.children[i], n.children[i+1]
+		child.items = append(child.items, n.items[i])
+		n.items[i] = right.items[0]
+		right.items = append(right.items[:0], right.items[1:]...)
+		if !right.leaf() {
+			child.children = append(child.children, right.children[0])
+			right.children = append(right.children[:0], right.children[1:]...)
+		}
+	case i < len(n.children)-1:
+		n.merge(i)
+	default:
+		n.merge(i - 1)
+		i--
+	}
+	return i
+}
+
+// 将第i个元素和第i+1个子节点合并到第i个子节点
+func (n *bnode) merge(i int) {
+	child, right := n.children[i], n.children[i+1]
+	child.items = append(child.items, n.items[i])
+	child.items = append(child.items, right.items...)
+	child.children = append(child.children, right.children...)
+
+	n.items = append(n.items[:i], n.items[i+1:]...)
+	n.children = append(n.children[:i+1], n.children[i+2:]...)
+}
+
+func (n *bnode) min() bitem {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.items[0]
+}
+
+func (n *bnode) max() bitem {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.items[len(n.items)-1]
+}
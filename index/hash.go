@@ -0,0 +1,103 @@
+package index
+
+type (
+	// Hash 哈希表, 键 -> 字段 -> 值
+	Hash struct {
+		usage
+		record map[string]map[string][]byte
+	}
+)
+
+// NewHash 建立哈希表
+func NewHash() *Hash {
+	return &Hash{record: make(map[string]map[string][]byte)}
+}
+
+// HSet 设置字段的值, 返回新增字段的数量
+func (h *Hash) HSet(key string, field string, value []byte) int {
+	if _, exist := h.record[key]; !exist {
+		h.record[key] = make(map[string][]byte)
+		h.add(len(key) + keyOverhead)
+	}
+
+	res := 0
+	if old, exist := h.record[key][field]; !exist {
+		res = 1
+		h.add(len(field) + len(value) + elementOverhead)
+	} else {
+		h.add(len(value) - len(old))
+	}
+	h.record[key][field] = value
+
+	// 返回
+	return res
+}
+
+// HGet 获取字段的值
+func (h *Hash) HGet(key string, field string) []byte {
+	if !h.exist(key) {
+		return nil
+	}
+	return h.record[key][field]
+}
+
+// HDel 删除字段, 返回被删除字段的数量
+func (h *Hash) HDel(key string, field string) int {
+	if !h.exist(key) {
+		return 0
+	}
+
+	old, exist := h.record[key][field]
+	if !exist {
+		return 0
+	}
+	delete(h.record[key], field)
+	h.add(-(len(field) + len(old) + elementOverhead))
+
+	// 字段为空时删除整个键
+	if len(h.record[key]) == 0 {
+		delete(h.record, key)
+		h.add(-(len(key) + keyOverhead))
+	}
+
+	// 返回
+	return 1
+}
+
+// HExists 判断字段是否存在
+func (h *Hash) HExists(key string, field string) bool {
+	if !h.exist(key) {
+		return false
+	}
+	_, exist := h.record[key][field]
+	return exist
+}
+
+// HLen 返回字段数量
+func (h *Hash) HLen(key string) int {
+	if !h.exist(key) {
+		return 0
+	}
+	return len(h.record[key])
+}
+
+// HGetAll 返回所有的字段和值, 字段和值交替排列
+func (h *Hash) HGetAll(key string) (res [][]byte) {
+	if !h.exist(key) {
+		return nil
+	}
+	for field, value := range h.record[key] {
+		res = append(res, []byte(field), value)
+	}
+	return
+}
+
+// HKeyExists 判断键是否存在
+func (h *Hash) HKeyExists(key string) bool {
+	return h.exist(key)
+}
+
+func (h *Hash) exist(key string) bool {
+	_, exist := h.record[key]
+	return exist
+}
@@ -0,0 +1,94 @@
+package index
+
+import (
+	"sort"
+	"sync"
+)
+
+// HashMap 基于哈希表的字符串索引表, 单键查询为O(1)
+// 有序遍历时对所有的键排序, 结果一直使用到键的集合发生变化
+type HashMap struct {
+	record map[string]*Indexer
+
+	// 排序后的键, 为空表示需要重新排序
+	mu     sync.Mutex
+	sorted []string
+}
+
+// NewHashMap 建立基于哈希表的字符串索引表
+func NewHashMap() *HashMap {
+	return &HashMap{record: make(map[string]*Indexer)}
+}
+
+// Get 查询键的索引信息
+func (h *HashMap) Get(key []byte) *Indexer {
+	return h.record[string(key)]
+}
+
+// Put 插入或更新键的索引信息, 返回旧的索引信息
+func (h *HashMap) Put(key []byte, idx *Indexer) *Indexer {
+	old, exist := h.record[string(key)]
+	if !exist {
+		h.sorted = nil
+	}
+	h.record[string(key)] = idx
+	return old
+}
+
+// Delete 删除键, 返回被删除的索引信息
+func (h *HashMap) Delete(key []byte) *Indexer {
+	old, exist := h.record[string(key)]
+	if !exist {
+		return nil
+	}
+	delete(h.record, string(key))
+	h.sorted = nil
+	return old
+}
+
+// Iterator 返回按键的字节序遍历的迭代器
+func (h *HashMap) Iterator() Iterator {
+	return &iterator{s: h}
+}
+
+// Len 返回键的数量
+func (h *HashMap) Len() int {
+	return len(h.record)
+}
+
+func (h *HashMap) seek(key []byte) ([]byte, *Indexer) {
+	keys := h.keys()
+	i := sort.SearchStrings(keys, string(key))
+	return h.item(keys, i)
+}
+
+func (h *HashMap) seekBefore(key []byte) ([]byte, *Indexer) {
+	keys := h.keys()
+	if key == nil {
+		return h.item(keys, len(keys)-1)
+	}
+	i := sort.SearchStrings(keys, string(key))
+	return h.item(keys, i-1)
+}
+
+func (h *HashMap) item(keys []string, i int) ([]byte, *Indexer) {
+	if i < 0 || i >= len(keys) {
+		return nil, nil
+	}
+	return []byte(keys[i]), h.record[keys[i]]
+}
+
+// 返回排序后的键, 查询可以并发执行, 排序需要加锁
+func (h *HashMap) keys() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sorted == nil && len(h.record) > 0 {
+		h.sorted = make([]string, 0, len(h.record))
+		for key := range h.record {
+			h.sorted = append(h.sorted, key)
+		}
+		sort.Strings(h.sorted)
+	}
+	return h.sorted
+}
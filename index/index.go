@@ -0,0 +1,176 @@
+package index
+
+// Type 字符串索引表的实现方式
+type Type int8
+
+const (
+	// SkipListIndex 跳跃表, 有序
+	SkipListIndex Type = iota
+	// HashMapIndex 哈希表, 适合只有单键查询的场景, 有序遍历时需要先对键排序
+	HashMapIndex
+	// BTreeIndex 内存B树, 有序
+	BTreeIndex
+	// ARTIndex 自适应基数树, 有序, 公共前缀多的键占用内存更少
+	ARTIndex
+)
+
+// Index 字符串索引表, 键 -> 索引信息
+// 查询和遍历可以并发执行, 修改操作需要调用方保证与其他操作互斥
+type Index interface {
+	// Get 查询键的索引信息, 键不存在时返回空
+	Get(key []byte) *Indexer
+	// Put 插入或更新键的索引信息, 返回旧的索引信息, idx不能为空
+	Put(key []byte, idx *Indexer) *Indexer
+	// Delete 删除键, 返回被删除的索引信息
+	Delete(key []byte) *Indexer
+	// Iterator 返回按键的字节序遍历的迭代器
+	Iterator() Iterator
+	// Len 返回键的数量
+	Len() int
+}
+
+// Iterator 索引表迭代器, 索引表被修改后需要重新定位
+type Iterator interface {
+	// Seek 定位到第一个大于等于key的键
+	Seek(key []byte)
+	// SeekBefore 定位到最后一个小于key的键, key为空时定位到最后一个键
+	SeekBefore(key []byte)
+	// Next 移动到下一个键
+	Next()
+	// Prev 移动到上一个键
+	Prev()
+	// Valid 判断当前位置是否有效
+	Valid() bool
+	// Key 返回当前的键, 不能修改
+	Key() []byte
+	// Value 返回当前键的索引信息
+	Value() *Indexer
+}
+
+// LockFreeGet 判断查询是否可以与修改同时执行而不需要加锁, 只有跳跃表支持
+func LockFreeGet(i Index) bool {
+	_, ok := i.(*skipListIndex)
+	return ok
+}
+
+// NewIndex 根据类型建立字符串索引表, 未知的类型使用跳跃表
+func NewIndex(t Type) Index {
+	switch t {
+	case HashMapIndex:
+		return NewHashMap()
+	case BTreeIndex:
+		return NewBTree()
+	case ARTIndex:
+		return NewART()
+	}
+	return NewSkipListIndex()
+}
+
+// 有序查找, 各实现只需提供这两个操作, 迭代器的移动都转化为重新查找
+type seeker interface {
+	// 第一个大于等于key的键
+	seek(key []byte) ([]byte, *Indexer)
+	// 最后一个小于key的键, key为空时返回最后一个键
+	seekBefore(key []byte) ([]byte, *Indexer)
+}
+
+type iterator struct {
+	s     seeker
+	key   []byte
+	value *Indexer
+}
+
+func (it *iterator) Seek(key []byte) {
+	it.key, it.value = it.s.seek(key)
+}
+
+func (it *iterator) SeekBefore(key []byte) {
+	it.key, it.value = it.s.seekBefore(key)
+}
+
+func (it *iterator) Next() {
+	if it.Valid() {
+		it.Seek(successor(it.key))
+	}
+}
+
+func (it *iterator) Prev() {
+	if it.Valid() {
+		it.SeekBefore(it.key)
+	}
+}
+
+func (it *iterator) Valid() bool {
+	return it.value != nil
+}
+
+func (it *iterator) Key() []byte {
+	return it.key
+}
+
+func (it *iterator) Value() *Indexer {
+	return it.value
+}
+
+// 大于key的最小键
+func successor(key []byte) []byte {
+	res := make([]byte, len(key)+1)
+	copy(res, key)
+	return res
+}
+
+// 基于跳跃表的字符串索引表
+type skipListIndex struct {
+	skl *SkipList
+}
+
+// NewSkipListIndex 建立基于跳跃表的字符串索引表
+func NewSkipListIndex() Index {
+	return &skipListIndex{skl: InitSkl()}
+}
+
+func (s *skipListIndex) Get(key []byte) *Indexer {
+	if e := s.skl.Find(key); e != nil {
+		return e.Value().(*Indexer)
+	}
+	return nil
+}
+
+func (s *skipListIndex) Put(key []byte, idx *Indexer) *Indexer {
+	old := s.Get(key)
+	s.skl.Insert(key, idx)
+	return old
+}
+
+func (s *skipListIndex) Delete(key []byte) *Indexer {
+	if e := s.skl.Remove(key); e != nil {
+		return e.Value().(*Indexer)
+	}
+	return nil
+}
+
+func (s *skipListIndex) Iterator() Iterator {
+	return &iterator{s: s}
+}
+
+func (s *skipListIndex) Len() int {
+	return s.skl.Size()
+}
+
+func (s *skipListIndex) seek(key []byte) ([]byte, *Indexer) {
+	return nodeItem(s.skl.Seek(key))
+}
+
+func (s *skipListIndex) seekBefore(key []byte) ([]byte, *Indexer) {
+	if key == nil {
+		return nodeItem(s.skl.Back())
+	}
+	return nodeItem(s.skl.SeekBefore(key))
+}
+
+func nodeItem(node *Node) ([]byte, *Indexer) {
+	if node == nil {
+		return nil, nil
+	}
+	return node.Key(), node.Value().(*Indexer)
+}
@@ -0,0 +1,251 @@
+package index
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// 各种实现都需要满足的行为, 包括磁盘B+树
+var backends = []struct {
+	name string
+	open func(t *testing.T) Index
+}{
+	{"skiplist", func(t *testing.T) Index { return NewIndex(SkipListIndex) }},
+	{"hashmap", func(t *testing.T) Index { return NewIndex(HashMapIndex) }},
+	{"btree", func(t *testing.T) Index { return NewIndex(BTreeIndex) }},
+	{"art", func(t *testing.T) Index { return NewIndex(ARTIndex) }},
+	{"bptree", openTestBPTree},
+}
+
+// 缓存页数较少, 使测试覆盖页的换出和重新读取
+func openTestBPTree(t *testing.T) Index {
+	dir, err := ioutil.TempDir("", "bptree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := OpenBPTree(filepath.Join(dir, "index.bpt"), 16)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tree.Close()
+		os.RemoveAll(dir)
+	})
+	return tree
+}
+
+func testIndexer(key []byte, fid uint32) *Indexer {
+	return &Indexer{FileId: fid, EntrySize: uint32(len(key)), Offset: int64(fid) * 100}
+}
+
+// 磁盘B+树返回的是副本, 只比较位置信息
+func sameIndexer(a, b *Indexer) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.FileId == b.FileId && a.EntrySize == b.EntrySize && a.Offset == b.Offset
+}
+
+func TestIndexOperations(t *testing.T) {
+	const none = 0
+	ops := []struct {
+		op   string
+		key  string
+		fid  uint32
+		want uint32 // 返回的旧索引信息的文件id, none表示返回空
+	}{
+		{"get", "a", 0, none},
+		{"delete", "a", 0, none},
+		{"put", "b", 1, none},
+		{"put", "a", 2, none},
+		{"put", "ab", 3, none},
+		{"get", "a", 0, 2},
+		{"get", "ab", 0, 3},
+		{"get", "abc", 0, none},
+		{"put", "a", 4, 2},
+		{"get", "a", 0, 4},
+		{"delete", "a", 0, 4},
+		{"get", "a", 0, none},
+		{"get", "ab", 0, 3},
+		{"delete", "a", 0, none},
+		{"put", "a", 5, none},
+		{"delete", "b", 0, 1},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			idx := b.open(t)
+			ref := make(map[string]*Indexer)
+			for i, o := range ops {
+				var got *Indexer
+				switch o.op {
+				case "get":
+					got = idx.Get([]byte(o.key))
+				case "put":
+					v := testIndexer([]byte(o.key), o.fid)
+					got = idx.Put([]byte(o.key), v)
+					ref[o.key] = v
+				case "delete":
+					got = idx.Delete([]byte(o.key))
+					delete(ref, o.key)
+				}
+				if o.want == none && got != nil {
+					t.Fatalf("op %d %s %q: got fid %d, want nil", i, o.op, o.key, got.FileId)
+				}
+				if o.want != none && (got == nil || got.FileId != o.want) {
+					t.Fatalf("op %d %s %q: got %+v, want fid %d", i, o.op, o.key, got, o.want)
+				}
+				if idx.Len() != len(ref) {
+					t.Fatalf("op %d: len %d, want %d", i, idx.Len(), len(ref))
+				}
+			}
+		})
+	}
+}
+
+func TestIndexRandom(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			idx := b.open(t)
+			ref := make(map[string]*Indexer)
+
+			// 字母表较小, 键之间有较多的公共前缀
+			randKey := func() []byte {
+				key := make([]byte, 1+r.Intn(40))
+				for i := range key {
+					key[i] = "abc\x00\xff"[r.Intn(5)]
+				}
+				return key
+			}
+
+			for i := 0; i < 5000; i++ {
+				key := randKey()
+				switch n := r.Intn(10); {
+				case n < 6:
+					v := testIndexer(key, uint32(i+1))
+					if old := idx.Put(key, v); !sameIndexer(old, ref[string(key)]) {
+						t.Fatalf("put %q: got %+v, want %+v", key, old, ref[string(key)])
+					}
+					ref[string(key)] = v
+				case n < 9:
+					if old := idx.Delete(key); !sameIndexer(old, ref[string(key)]) {
+						t.Fatalf("delete %q: got %+v, want %+v", key, old, ref[string(key)])
+					}
+					delete(ref, string(key))
+				default:
+					if got := idx.Get(key); !sameIndexer(got, ref[string(key)]) {
+						t.Fatalf("get %q: got %+v, want %+v", key, got, ref[string(key)])
+					}
+				}
+			}
+			if idx.Len() != len(ref) {
+				t.Fatalf("len %d, want %d", idx.Len(), len(ref))
+			}
+			for key, v := range ref {
+				if got := idx.Get([]byte(key)); !sameIndexer(got, v) {
+					t.Fatalf("get %q: got %+v, want %+v", key, got, v)
+				}
+			}
+
+			var keys []string
+			for key := range ref {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			checkOrder(t, idx, keys, ref)
+			for i := 0; i < 500; i++ {
+				checkSeek(t, idx, keys, ref, randKey())
+			}
+			checkSeek(t, idx, keys, ref, nil)
+		})
+	}
+}
+
+// 从两端完整遍历, 顺序需要与排序后的键一致
+func checkOrder(t *testing.T, idx Index, keys []string, ref map[string]*Indexer) {
+	t.Helper()
+	it := idx.Iterator()
+	i := 0
+	for it.Seek(nil); it.Valid(); it.Next() {
+		if i >= len(keys) || string(it.Key()) != keys[i] || !sameIndexer(it.Value(), ref[keys[i]]) {
+			t.Fatalf("next %d: got %q", i, it.Key())
+		}
+		i++
+	}
+	if i != len(keys) {
+		t.Fatalf("next visited %d keys, want %d", i, len(keys))
+	}
+
+	i = len(keys) - 1
+	for it.SeekBefore(nil); it.Valid(); it.Prev() {
+		if i < 0 || string(it.Key()) != keys[i] {
+			t.Fatalf("prev %d: got %q", i, it.Key())
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("prev stopped at %d", i)
+	}
+}
+
+// 定位之后前后移动一步, 结果需要与在排序后的键中二分查找一致
+func checkSeek(t *testing.T, idx Index, keys []string, ref map[string]*Indexer, key []byte) {
+	t.Helper()
+	at := func(i int) string {
+		if i < 0 || i >= len(keys) {
+			return ""
+		}
+		return keys[i]
+	}
+	check := func(what string, it Iterator, want string) {
+		t.Helper()
+		if want == "" {
+			if it.Valid() {
+				t.Fatalf("%s %q: got %q, want invalid", what, key, it.Key())
+			}
+			return
+		}
+		if !it.Valid() || !bytes.Equal(it.Key(), []byte(want)) || !sameIndexer(it.Value(), ref[want]) {
+			t.Fatalf("%s %q: got %q, want %q", what, key, it.Key(), want)
+		}
+	}
+
+	i := sort.SearchStrings(keys, string(key))
+	it := idx.Iterator()
+	it.Seek(key)
+	check("seek", it, at(i))
+	it.Next()
+	check("seek+next", it, at(i+1))
+	// 无效的位置不再移动
+	it.Seek(key)
+	it.Prev()
+	if i < len(keys) {
+		check("seek+prev", it, at(i-1))
+	} else {
+		check("seek+prev", it, "")
+	}
+
+	// key为空时定位到最后一个键
+	before := i - 1
+	if key == nil {
+		before = len(keys) - 1
+	}
+	it.SeekBefore(key)
+	check("seekbefore", it, at(before))
+	it.Prev()
+	check("seekbefore+prev", it, at(before-1))
+	it.SeekBefore(key)
+	it.Next()
+	if before >= 0 {
+		check("seekbefore+next", it, at(before+1))
+	} else {
+		check("seekbefore+next", it, "")
+	}
+}
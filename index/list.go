@@ -0,0 +1,261 @@
+package index
+
+import (
+	"bytes"
+	"container/list"
+)
+
+type (
+	// List 列表, 键 -> 双向链表
+	List struct {
+		usage
+		record map[string]*list.List
+	}
+)
+
+// NewList 建立列表
+func NewList() *List {
+	return &List{record: make(map[string]*list.List)}
+}
+
+// LPush 在列表头部插入元素, 返回列表长度
+func (l *List) LPush(key string, values ...[]byte) int {
+	return l.push(true, key, values...)
+}
+
+// RPush 在列表尾部插入元素, 返回列表长度
+func (l *List) RPush(key string, values ...[]byte) int {
+	return l.push(false, key, values...)
+}
+
+// LPop 弹出列表头部元素
+func (l *List) LPop(key string) []byte {
+	return l.pop(true, key)
+}
+
+// RPop 弹出列表尾部元素
+func (l *List) RPop(key string) []byte {
+	return l.pop(false, key)
+}
+
+// LIndex 返回下标对应的元素, 下标可以为负数, 元素可能为空, 用ok区分下标越界
+func (l *List) LIndex(key string, index int) (value []byte, ok bool) {
+	ele := l.element(key, index)
+	if ele == nil {
+		return nil, false
+	}
+	return ele.Value.([]byte), true
+}
+
+// LSet 设置下标对应元素的值
+func (l *List) LSet(key string, index int, value []byte) bool {
+	ele := l.element(key, index)
+	if ele == nil {
+		return false
+	}
+	l.add(len(value) - len(ele.Value.([]byte)))
+	ele.Value = value
+	return true
+}
+
+// LLen 返回列表长度
+func (l *List) LLen(key string) int {
+	if !l.exist(key) {
+		return 0
+	}
+	return l.record[key].Len()
+}
+
+// LRem 删除与value相等的元素, count > 0 从头部开始删除count个,
+// count < 0 从尾部开始删除|count|个, count = 0 删除全部, 返回删除的数量
+func (l *List) LRem(key string, value []byte, count int) int {
+	if !l.exist(key) {
+		return 0
+	}
+
+	item := l.record[key]
+	var removed []*list.Element
+	if count >= 0 {
+		for p := item.Front(); p != nil; p = p.Next() {
+			if bytes.Equal(p.Value.([]byte), value) {
+				removed = append(removed, p)
+				if len(removed) == count {
+					break
+				}
+			}
+		}
+	} else {
+		for p := item.Back(); p != nil; p = p.Prev() {
+			if bytes.Equal(p.Value.([]byte), value) {
+				removed = append(removed, p)
+				if len(removed) == -count {
+					break
+				}
+			}
+		}
+	}
+
+	for _, e := range removed {
+		l.remove(item, e)
+	}
+	l.clean(key)
+
+	// 返回
+	return len(removed)
+}
+
+// LTrim 只保留下标在[start, end]之间的元素
+func (l *List) LTrim(key string, start, end int) {
+	if !l.exist(key) {
+		return
+	}
+
+	item := l.record[key]
+	start, end = handleIndex(item.Len(), start, end)
+
+	i := 0
+	for p := item.Front(); p != nil; i++ {
+		next := p.Next()
+		if i < start || i > end {
+			l.remove(item, p)
+		}
+		p = next
+	}
+
+	// 区间为空则删除整个列表
+	l.clean(key)
+}
+
+// LRange 返回下标在[start, end]之间的元素
+func (l *List) LRange(key string, start, end int) (res [][]byte) {
+	if !l.exist(key) {
+		return nil
+	}
+
+	item := l.record[key]
+	start, end = handleIndex(item.Len(), start, end)
+
+	i := 0
+	for p := item.Front(); p != nil && i <= end; p, i = p.Next(), i+1 {
+		if i >= start {
+			res = append(res, p.Value.([]byte))
+		}
+	}
+	return
+}
+
+// LKeyExists 判断键是否存在
+func (l *List) LKeyExists(key string) bool {
+	return l.exist(key)
+}
+
+// Keys 返回所有的键
+func (l *List) Keys() (keys []string) {
+	for key := range l.record {
+		keys = append(keys, key)
+	}
+	return
+}
+
+func (l *List) push(front bool, key string, values ...[]byte) int {
+	if !l.exist(key) {
+		l.record[key] = list.New()
+		l.add(len(key) + keyOverhead)
+	}
+
+	for _, v := range values {
+		if front {
+			l.record[key].PushFront(v)
+		} else {
+			l.record[key].PushBack(v)
+		}
+		l.add(len(v) + elementOverhead)
+	}
+	return l.record[key].Len()
+}
+
+func (l *List) pop(front bool, key string) []byte {
+	if !l.exist(key) {
+		return nil
+	}
+
+	item := l.record[key]
+	var ele *list.Element
+	if front {
+		ele = item.Front()
+	} else {
+		ele = item.Back()
+	}
+
+	value := l.remove(item, ele)
+	l.clean(key)
+
+	// 返回
+	return value
+}
+
+// 根据下标查找链表节点, 下标为负数时从尾部开始计算
+func (l *List) element(key string, index int) *list.Element {
+	if !l.exist(key) {
+		return nil
+	}
+
+	item := l.record[key]
+	if index < 0 {
+		index += item.Len()
+	}
+	if index < 0 || index >= item.Len() {
+		return nil
+	}
+
+	// 根据下标位置选择遍历方向
+	if index <= item.Len()/2 {
+		p := item.Front()
+		for i := 0; i < index; i++ {
+			p = p.Next()
+		}
+		return p
+	}
+	p := item.Back()
+	for i := item.Len() - 1; i > index; i-- {
+		p = p.Prev()
+	}
+	return p
+}
+
+// 删除链表节点, 返回节点的值
+func (l *List) remove(item *list.List, ele *list.Element) []byte {
+	value := item.Remove(ele).([]byte)
+	l.add(-(len(value) + elementOverhead))
+	return value
+}
+
+// 列表为空时删除键
+func (l *List) clean(key string) {
+	if l.record[key].Len() == 0 {
+		delete(l.record, key)
+		l.add(-(len(key) + keyOverhead))
+	}
+}
+
+func (l *List) exist(key string) bool {
+	_, exist := l.record[key]
+	return exist
+}
+
+// 处理下标, 负数下标转换为正数并限制在[0, size-1]之间
+func handleIndex(size, start, end int) (int, int) {
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end
+}
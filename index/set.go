@@ -0,0 +1,163 @@
+package index
+
+import "math/rand"
+
+type (
+	// Set 集合, 键 -> 成员集合
+	Set struct {
+		usage
+		record map[string]map[string]struct{}
+	}
+)
+
+// NewSet 建立集合
+func NewSet() *Set {
+	return &Set{record: make(map[string]map[string]struct{})}
+}
+
+// SAdd 添加成员, 返回新增成员的数量
+func (s *Set) SAdd(key string, member []byte) int {
+	if !s.exist(key) {
+		s.record[key] = make(map[string]struct{})
+		s.add(len(key) + keyOverhead)
+	}
+
+	if _, exist := s.record[key][string(member)]; exist {
+		return 0
+	}
+	s.record[key][string(member)] = struct{}{}
+	s.add(len(member) + elementOverhead)
+	return 1
+}
+
+// SRem 删除成员, 返回被删除成员的数量
+func (s *Set) SRem(key string, member []byte) int {
+	if !s.SIsMember(key, member) {
+		return 0
+	}
+
+	delete(s.record[key], string(member))
+	s.add(-(len(member) + elementOverhead))
+
+	// 成员为空时删除整个键
+	if len(s.record[key]) == 0 {
+		delete(s.record, key)
+		s.add(-(len(key) + keyOverhead))
+	}
+	return 1
+}
+
+// SIsMember 判断是否为集合成员
+func (s *Set) SIsMember(key string, member []byte) bool {
+	if !s.exist(key) {
+		return false
+	}
+	_, exist := s.record[key][string(member)]
+	return exist
+}
+
+// SMembers 返回所有成员
+func (s *Set) SMembers(key string) (res [][]byte) {
+	if !s.exist(key) {
+		return nil
+	}
+	for member := range s.record[key] {
+		res = append(res, []byte(member))
+	}
+	return
+}
+
+// SCard 返回成员数量
+func (s *Set) SCard(key string) int {
+	if !s.exist(key) {
+		return 0
+	}
+	return len(s.record[key])
+}
+
+// SRandMember 随机返回成员, count > 0 返回不重复的成员, count < 0 返回的成员可能重复
+func (s *Set) SRandMember(key string, count int) (res [][]byte) {
+	members := s.SMembers(key)
+	if len(members) == 0 || count == 0 {
+		return nil
+	}
+
+	if count > 0 {
+		rand.Shuffle(len(members), func(i, j int) {
+			members[i], members[j] = members[j], members[i]
+		})
+		if count > len(members) {
+			count = len(members)
+		}
+		return members[:count]
+	}
+
+	for i := 0; i < -count; i++ {
+		res = append(res, members[rand.Intn(len(members))])
+	}
+	return
+}
+
+// SUnion 返回多个集合的并集
+func (s *Set) SUnion(keys ...string) (res [][]byte) {
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		for member := range s.record[key] {
+			if _, exist := seen[member]; !exist {
+				seen[member] = struct{}{}
+				res = append(res, []byte(member))
+			}
+		}
+	}
+	return
+}
+
+// SInter 返回多个集合的交集
+func (s *Set) SInter(keys ...string) (res [][]byte) {
+	if len(keys) == 0 {
+		return nil
+	}
+	for member := range s.record[keys[0]] {
+		inAll := true
+		for _, key := range keys[1:] {
+			if _, exist := s.record[key][member]; !exist {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			res = append(res, []byte(member))
+		}
+	}
+	return
+}
+
+// SDiff 返回第一个集合与其余集合的差集
+func (s *Set) SDiff(keys ...string) (res [][]byte) {
+	if len(keys) == 0 {
+		return nil
+	}
+	for member := range s.record[keys[0]] {
+		inOther := false
+		for _, key := range keys[1:] {
+			if _, exist := s.record[key][member]; exist {
+				inOther = true
+				break
+			}
+		}
+		if !inOther {
+			res = append(res, []byte(member))
+		}
+	}
+	return
+}
+
+// SKeyExists 判断键是否存在
+func (s *Set) SKeyExists(key string) bool {
+	return s.exist(key)
+}
+
+func (s *Set) exist(key string) bool {
+	_, exist := s.record[key]
+	return exist
+}
@@ -1,152 +1,365 @@
 package index
 
 import (
+	"bytes"
 	"fmt"
-	"math/rand"
+	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
-var (
-	maxLevel int = 10
+const (
+	// 跳跃表的最大层数
+	maxLevel = 32
+	// 节点每升高一层的概率为1/4
+	levelBits = 2
 )
 
 type (
-	// SkipList 跳跃表
+	// SkipList 无锁并发跳跃表, 查询不加锁, 插入和删除通过CAS修改指针
+	// 删除节点时先标记各层的后继指针, 再从链表中摘除, 查询时跳过已标记的节点
 	SkipList struct {
+		// 64位原子操作的字段放在开头保证对齐
+		size int64
+		// 随机数状态, 每个跳跃表独立
+		seed uint64
+		// 当前最高的层数
+		height int32
+
 		header *Node
-		tail *Node
-		size int
+		// 最后一个节点, 使用前需要检查是否仍然有效
+		tail unsafe.Pointer
 	}
+
 	// Node 跳跃表节点
 	Node struct {
-		obj *element
-		level []*Node
+		key []byte
+		// *interface{}, 更新值时整体替换
+		val unsafe.Pointer
+		// 各层的后继, 指向不可变的*link
+		next []unsafe.Pointer
 	}
 
-	// 节点数据
-	element struct {
-		key []byte
-		val interface{}
+	// 带删除标记的后继指针, 后继和标记需要一起比较和替换
+	link struct {
+		node   *Node
+		marked bool
 	}
 )
 
-// Value 返回值信息
-func (e *element) Value() interface{} {
-	return e.val
-}
+// 没有后继的指针, 不可变, 可以共用
+var nilLink = unsafe.Pointer(&link{})
 
 // InitSkl 建立跳跃表
 func InitSkl() *SkipList {
-	head := &Node{
-		nil,
-		make([]*Node, maxLevel),
+	return &SkipList{
+		seed:   uint64(time.Now().UnixNano()) | 1,
+		height: 1,
+		header: newNode(nil, nil, maxLevel),
 	}
-	return &SkipList{header: head, tail: nil, size: 0}
 }
 
-// Find 查询节点信息
-func (sk *SkipList) Find(key []byte) *element {
-	node := sk.header
-	for i := maxLevel-1; i >= 0; i-- {
-		for node.level[i] != nil && string(node.level[i].obj.key) < string(key) {
-			node = node.level[i]
+func newNode(key []byte, value interface{}, level int) *Node {
+	n := &Node{key: key, val: unsafe.Pointer(&value), next: make([]unsafe.Pointer, level)}
+	for i := range n.next {
+		n.next[i] = nilLink
+	}
+	return n
+}
+
+// Key 返回节点的键
+func (n *Node) Key() []byte {
+	return n.key
+}
+
+// Value 返回节点的值
+func (n *Node) Value() interface{} {
+	return *(*interface{})(atomic.LoadPointer(&n.val))
+}
+
+// Next 返回下一个节点
+func (n *Node) Next() *Node {
+	return n.nextAt(0)
+}
+
+// 返回第level层的下一个未被删除的节点
+func (n *Node) nextAt(level int) *Node {
+	next, _ := n.loadNext(level)
+	for next != nil {
+		succ, marked := next.loadNext(level)
+		if !marked {
+			return next
 		}
+		next = succ
 	}
-	node = node.level[0]
-	if node != nil && string(node.obj.key) == string(key) {
-		return node.obj
+	return nil
+}
+
+func (n *Node) loadNext(level int) (*Node, bool) {
+	l := (*link)(atomic.LoadPointer(&n.next[level]))
+	return l.node, l.marked
+}
+
+// 第level层的后继为(old, oldMarked)时替换为(succ, marked)
+func (n *Node) casNext(level int, old *Node, oldMarked bool, succ *Node, marked bool) bool {
+	p := atomic.LoadPointer(&n.next[level])
+	if l := (*link)(p); l.node != old || l.marked != oldMarked {
+		return false
+	}
+	return atomic.CompareAndSwapPointer(&n.next[level], p, unsafe.Pointer(&link{node: succ, marked: marked}))
+}
+
+// 第0层被标记表示节点已经删除
+func (n *Node) deleted() bool {
+	_, marked := n.loadNext(0)
+	return marked
+}
+
+// Size 返回节点数量
+func (sk *SkipList) Size() int {
+	return int(atomic.LoadInt64(&sk.size))
+}
+
+// Find 查询节点信息
+func (sk *SkipList) Find(key []byte) *Node {
+	if _, node := sk.search(key); node != nil && bytes.Equal(node.key, key) {
+		return node
 	}
 	return nil
 }
 
-// Insert 插入节点
-func (sk *SkipList) Insert(key []byte, value interface{}) bool {
-	node := sk.header
-	update := make([]*Node, maxLevel)
+// Front 返回第一个节点
+func (sk *SkipList) Front() *Node {
+	return sk.header.Next()
+}
 
-	// 查找插入节点的前驱节点
-	for i := maxLevel-1; i >= 0; i-- {
-		for node.level[i] != nil && string(node.level[i].obj.key) < string(key) {
-			node = node.level[i]
+// Back 返回最后一个节点
+func (sk *SkipList) Back() *Node {
+	if tail := (*Node)(atomic.LoadPointer(&sk.tail)); tail != nil {
+		if next, marked := tail.loadNext(0); next == nil && !marked {
+			return tail
 		}
-		update[i] = node
 	}
 
-	// 如果插入节点已经存在, 更新节点信息
-	if node.level[0] != nil && string(node.level[0].obj.key) == string(key) {
-		node.level[0].obj.val = value
-		return false
+	// 记录的节点已经失效, 从最高层开始查找
+	node := sk.header
+	for level := sk.level() - 1; level >= 0; level-- {
+		for next := node.nextAt(level); next != nil; next = node.nextAt(level) {
+			node = next
+		}
 	}
+	if node == sk.header {
+		return nil
+	}
+	atomic.StorePointer(&sk.tail, unsafe.Pointer(node))
+	return node
+}
 
-	// 长度加一
-	sk.size++
-	// 获取节点层数
-	nodeLevel := getRandomLevel()
-
-	// 新建插入节点
-	newNode := &Node{&element{key: key, val: value}, make([]*Node, nodeLevel)}
+// Seek 查找第一个键大于等于key的节点
+func (sk *SkipList) Seek(key []byte) *Node {
+	_, node := sk.search(key)
+	return node
+}
 
-	// 修改前驱指针
-	for i := nodeLevel-1; i >= 0; i-- {
-		node = update[i]
-		newNode.level[i] = node.level[i]
-		node.level[i] = newNode
+// SeekBefore 查找最后一个键小于key的节点
+func (sk *SkipList) SeekBefore(key []byte) *Node {
+	pred, _ := sk.search(key)
+	if pred == sk.header {
+		return nil
 	}
+	return pred
+}
+
+// Insert 插入节点, 键已经存在时更新值并返回false
+func (sk *SkipList) Insert(key []byte, value interface{}) bool {
+	var preds, succs [maxLevel]*Node
+	level := sk.randomLevel()
+	for {
+		// 如果插入节点已经存在, 更新节点信息
+		// 节点在查找之后被删除时更新会随节点一起丢失, 需要重新插入
+		if sk.find(key, preds[:], succs[:]) {
+			atomic.StorePointer(&succs[0].val, unsafe.Pointer(&value))
+			if !succs[0].deleted() {
+				return false
+			}
+			continue
+		}
+
+		// 新建插入节点, 先链入第0层, 成功后节点即可被查询到
+		node := newNode(key, value, level)
+		for i := 0; i < level; i++ {
+			node.next[i] = unsafe.Pointer(&link{node: succs[i]})
+		}
+		if !preds[0].casNext(0, succs[0], false, node, false) {
+			continue
+		}
 
-	// 返回
-	return true
+		// 长度加一
+		atomic.AddInt64(&sk.size, 1)
+		sk.raise(level)
+		sk.linkUpper(node, preds[:], succs[:])
+		sk.updateTail(node)
+		return true
+	}
 }
 
 // Traverse 遍历跳跃表
 func (sk *SkipList) Traverse() {
-	node := sk.header.level[0]
-	for node != nil {
-		fmt.Printf("%s ", node.obj.key)
-		node = node.level[0]
+	for node := sk.Front(); node != nil; node = node.Next() {
+		fmt.Printf("%s ", node.key)
 	}
 	fmt.Println()
 }
 
-// Remove 删除节点
-func (sk *SkipList) Remove(key []byte) *element {
-	node := sk.header
-	update := make([]*Node, maxLevel)
+// Remove 删除节点, 返回被删除的节点
+func (sk *SkipList) Remove(key []byte) *Node {
+	var preds, succs [maxLevel]*Node
+	if !sk.find(key, preds[:], succs[:]) {
+		return nil
+	}
+	node := succs[0]
 
-	// 查找待删除节点的前驱节点
-	for i := maxLevel-1; i >= 0; i-- {
-		for node.level[i] != nil && string(node.level[i].obj.key) < string(key) {
-			node = node.level[i]
+	// 从高到低标记各层的后继, 标记后其他协程不能再在该节点之后插入
+	for i := len(node.next) - 1; i > 0; i-- {
+		for {
+			next, marked := node.loadNext(i)
+			if marked || node.casNext(i, next, false, next, true) {
+				break
+			}
 		}
-		update[i] = node
 	}
 
-	// 删除节点不存在，返回false
-	if node.level[0] == nil || string(node.level[0].obj.key) != string(key) {
-		return nil
+	// 标记第0层成功的协程完成删除
+	for {
+		next, marked := node.loadNext(0)
+		if marked {
+			return nil
+		}
+		if node.casNext(0, next, false, next, true) {
+			// 长度减一
+			atomic.AddInt64(&sk.size, -1)
+			// 摘除已标记的节点
+			sk.find(key, preds[:], succs[:])
+			return node
+		}
 	}
+}
 
-	// node为要删除的节点
-	node = node.level[0]
+// 只读查找, 返回最后一个键小于key的节点和第一个键大于等于key的节点, 不修改链表
+func (sk *SkipList) search(key []byte) (pred, curr *Node) {
+	pred = sk.header
+	for level := sk.level() - 1; level >= 0; level-- {
+		curr = pred.nextAt(level)
+		for curr != nil && bytes.Compare(curr.key, key) < 0 {
+			pred, curr = curr, curr.nextAt(level)
+		}
+	}
+	return
+}
+
+// 查找key在各层的前驱和后继, 同时摘除路过的已标记节点, 返回第0层的后继是否为key
+func (sk *SkipList) find(key []byte, preds, succs []*Node) bool {
+retry:
+	for {
+		pred := sk.header
+		for level := maxLevel - 1; level >= 0; level-- {
+			curr, _ := pred.loadNext(level)
+			for curr != nil {
+				succ, marked := curr.loadNext(level)
+				if marked {
+					// 前驱已经变化时重新查找
+					if !pred.casNext(level, curr, false, succ, false) {
+						continue retry
+					}
+					curr = succ
+					continue
+				}
+				if bytes.Compare(curr.key, key) >= 0 {
+					break
+				}
+				pred, curr = curr, succ
+			}
+			preds[level], succs[level] = pred, curr
+		}
+		return succs[0] != nil && bytes.Equal(succs[0].key, key)
+	}
+}
 
-	// 删除node, 更新level指针的指向
-	for i := maxLevel-1; i >= 0; i-- {
-		if update[i].level[i] == node {
-			update[i].level[i] = node.level[i]
+// 将已经链入第0层的节点链入更高的层
+func (sk *SkipList) linkUpper(node *Node, preds, succs []*Node) {
+	for i := 1; i < len(node.next); i++ {
+		for {
+			// 节点正在被删除, 不再继续
+			next, marked := node.loadNext(i)
+			if marked {
+				return
+			}
+			pred, succ := preds[i], succs[i]
+			if next != succ && !node.casNext(i, next, false, succ, false) {
+				continue
+			}
+			if pred.casNext(i, succ, false, node, false) {
+				break
+			}
+			// 前驱或后继发生变化, 重新查找
+			if !sk.find(node.key, preds, succs) || succs[0] != node {
+				return
+			}
 		}
 	}
+}
 
-	// 长度减一
-	sk.size--
+// 插入的节点比记录的最后一个节点大时更新记录
+func (sk *SkipList) updateTail(node *Node) {
+	for {
+		p := atomic.LoadPointer(&sk.tail)
+		tail := (*Node)(p)
+		if node.deleted() || (tail != nil && !tail.deleted() && bytes.Compare(tail.key, node.key) >= 0) {
+			return
+		}
+		if atomic.CompareAndSwapPointer(&sk.tail, p, unsafe.Pointer(node)) {
+			return
+		}
+	}
+}
 
-	// 返回结果
-	// fmt.Printf("%x", node.obj.key)
-	return node.obj
+// 当前最高的层数
+func (sk *SkipList) level() int {
+	return int(atomic.LoadInt32(&sk.height))
+}
+
+// 插入更高的节点后更新最高层数
+func (sk *SkipList) raise(level int) {
+	for h := atomic.LoadInt32(&sk.height); int32(level) > h; h = atomic.LoadInt32(&sk.height) {
+		if atomic.CompareAndSwapInt32(&sk.height, h, int32(level)) {
+			return
+		}
+	}
 }
 
 // 获取随机层数
-func getRandomLevel() int {
-	rand.Seed(time.Now().UnixNano())
-	return rand.Intn(maxLevel-1)+1
+func (sk *SkipList) randomLevel() int {
+	x := sk.random()
+	level := 1
+	for level < maxLevel && x&(1<<levelBits-1) == 0 {
+		level++
+		x >>= levelBits
+	}
+	return level
+}
+
+// xorshift64*随机数, 通过CAS更新状态, 不需要加锁
+func (sk *SkipList) random() uint64 {
+	for {
+		old := atomic.LoadUint64(&sk.seed)
+		x := old
+		x ^= x >> 12
+		x ^= x << 25
+		x ^= x >> 27
+		if atomic.CompareAndSwapUint64(&sk.seed, old, x) {
+			return x * 2685821657736338717
+		}
+	}
 }
 
 //func main() {
@@ -0,0 +1,62 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+const benchKeys = 1 << 16
+
+func benchSkl() (*SkipList, [][]byte) {
+	skl := InitSkl()
+	keys := make([][]byte, benchKeys)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%08d", i))
+		skl.Insert(keys[i], i)
+	}
+	return skl, keys
+}
+
+// 每个协程使用独立的随机数生成器, 避免全局随机数的锁影响结果
+func benchRand(seed *int64) *rand.Rand {
+	return rand.New(rand.NewSource(atomic.AddInt64(seed, 1)))
+}
+
+func BenchmarkSklParallelRead(b *testing.B) {
+	skl, keys := benchSkl()
+	var seed int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := benchRand(&seed)
+		for pb.Next() {
+			skl.Find(keys[r.Intn(benchKeys)])
+		}
+	})
+}
+
+// 写操作中插入和删除各占一半, 键的数量大致保持不变
+func BenchmarkSklParallelMixed(b *testing.B) {
+	for _, writes := range []int{10, 50} {
+		b.Run(fmt.Sprintf("write%d%%", writes), func(b *testing.B) {
+			skl, keys := benchSkl()
+			var seed int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := benchRand(&seed)
+				for pb.Next() {
+					key := keys[r.Intn(benchKeys)]
+					switch n := r.Intn(100); {
+					case n >= writes:
+						skl.Find(key)
+					case n%2 == 0:
+						skl.Insert(key, n)
+					default:
+						skl.Remove(key)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package index
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// 每个键由一个协程插入递增的值, 另一个协程反复删除
+// 插入之后立即查询不到时, 插入的值一定被某次删除返回, 否则说明插入到了正在删除的节点上而丢失
+func TestSklConcurrentInsertRemove(t *testing.T) {
+	const (
+		keys   = 8
+		rounds = 20000
+	)
+	skl := InitSkl()
+	// 保证各层都有节点, 插入和删除需要修改多层指针
+	for i := 0; i < 256; i++ {
+		skl.Insert([]byte(fmt.Sprintf("fill-%03d", i)), -1)
+	}
+
+	var wg sync.WaitGroup
+	for k := 0; k < keys; k++ {
+		key := []byte(fmt.Sprintf("key-%d", k))
+		removed := make(map[int]bool)
+		lost := make(map[int]bool)
+		var mu sync.Mutex
+		done := make(chan struct{})
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			defer close(done)
+			for i := 0; i < rounds; i++ {
+				skl.Insert(key, i)
+				node := skl.Find(key)
+				if node == nil {
+					mu.Lock()
+					lost[i] = true
+					mu.Unlock()
+					continue
+				}
+				if v := node.Value().(int); v != i {
+					t.Errorf("find %s: got %d, want %d", key, v, i)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if node := skl.Remove(key); node != nil {
+					mu.Lock()
+					removed[node.Value().(int)] = true
+					mu.Unlock()
+				}
+			}
+		}()
+
+		t.Cleanup(func() {
+			for i := range lost {
+				if !removed[i] {
+					t.Errorf("%s: value %d was neither found nor removed", key, i)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	// 其他键不受影响, 长度与剩余的节点一致
+	n := 0
+	for node := skl.Front(); node != nil; node = node.Next() {
+		n++
+	}
+	if n != skl.Size() {
+		t.Fatalf("size %d, but %d nodes left", skl.Size(), n)
+	}
+	for i := 0; i < 256; i++ {
+		if skl.Find([]byte(fmt.Sprintf("fill-%03d", i))) == nil {
+			t.Fatalf("fill-%03d lost", i)
+		}
+	}
+}
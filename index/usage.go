@@ -0,0 +1,33 @@
+package index
+
+import "sync/atomic"
+
+const (
+	// 每个键除了键本身之外额外占用的内存估计
+	keyOverhead = 128
+	// 每个元素除了元素本身之外额外占用的内存估计
+	elementOverhead = 48
+)
+
+// 哈希, 列表, 集合和有序集合占用的内存估计, 修改时持有对应索引表的写锁, 读取不需要加锁
+type usage struct {
+	bytes int64
+}
+
+func (u *usage) add(n int) {
+	atomic.AddInt64(&u.bytes, int64(n))
+}
+
+// Memory 返回占用的内存估计
+func (u *usage) Memory() int64 {
+	return atomic.LoadInt64(&u.bytes)
+}
+
+// Cost 估计写入键和元素最多增加的内存, 用于写入之前检查内存上限
+func Cost(key []byte, elements ...[]byte) int64 {
+	n := len(key) + keyOverhead
+	for _, e := range elements {
+		n += len(e) + elementOverhead
+	}
+	return int64(n)
+}
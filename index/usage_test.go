@@ -0,0 +1,62 @@
+package index
+
+import (
+	"testing"
+)
+
+// 写入之后占用的内存增加, 全部删除之后回到0
+func TestCollectionMemory(t *testing.T) {
+	check := func(name string, mem interface{ Memory() int64 }, write, clear func()) {
+		t.Helper()
+		write()
+		if mem.Memory() <= 0 {
+			t.Fatalf("%s: memory %d after write", name, mem.Memory())
+		}
+		clear()
+		if mem.Memory() != 0 {
+			t.Fatalf("%s: memory %d after clear", name, mem.Memory())
+		}
+	}
+
+	h := NewHash()
+	check("hash", h, func() {
+		h.HSet("k", "a", []byte("1"))
+		h.HSet("k", "a", []byte("123"))
+		h.HSet("k", "b", nil)
+	}, func() {
+		h.HDel("k", "a")
+		h.HDel("k", "b")
+	})
+
+	l := NewList()
+	check("list", l, func() {
+		l.RPush("k", []byte("a"), []byte("b"), []byte("c"), []byte("b"))
+		l.LPush("j", []byte("x"))
+		l.LSet("k", 0, []byte("abc"))
+	}, func() {
+		l.LPop("k")
+		l.LRem("k", []byte("b"), 0)
+		l.LTrim("k", 1, 0)
+		l.RPop("j")
+	})
+
+	s := NewSet()
+	check("set", s, func() {
+		s.SAdd("k", []byte("a"))
+		s.SAdd("k", []byte("a"))
+		s.SAdd("k", []byte("b"))
+	}, func() {
+		s.SRem("k", []byte("a"))
+		s.SRem("k", []byte("b"))
+	})
+
+	z := NewSortedSet()
+	check("zset", z, func() {
+		z.ZAdd("k", 1, []byte("a"))
+		z.ZAdd("k", 2, []byte("a"))
+		z.ZIncrBy("k", 1, []byte("b"))
+	}, func() {
+		z.ZRem("k", []byte("a"))
+		z.ZRem("k", []byte("b"))
+	})
+}
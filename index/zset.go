@@ -0,0 +1,180 @@
+package index
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+type (
+	// SortedSet 有序集合, 键 -> 按分数排序的成员
+	SortedSet struct {
+		usage
+		record map[string]*sortedSet
+	}
+
+	// 单个有序集合, 跳跃表的键由分数和成员拼接而成, 先按分数再按成员排序
+	sortedSet struct {
+		dict map[string]float64
+		skl  *SkipList
+	}
+)
+
+// NewSortedSet 建立有序集合
+func NewSortedSet() *SortedSet {
+	return &SortedSet{record: make(map[string]*sortedSet)}
+}
+
+// ZAdd 添加成员或更新成员的分数, 返回新增成员的数量
+func (z *SortedSet) ZAdd(key string, score float64, member []byte) int {
+	if !z.exist(key) {
+		z.record[key] = &sortedSet{dict: make(map[string]float64), skl: InitSkl()}
+		z.add(len(key) + keyOverhead)
+	}
+
+	item := z.record[key]
+	old, exist := item.dict[string(member)]
+	if exist {
+		// 分数没有变化
+		if old == score {
+			return 0
+		}
+		item.skl.Remove(zslKey(old, member))
+	}
+
+	item.dict[string(member)] = score
+	item.skl.Insert(zslKey(score, member), member)
+
+	if exist {
+		return 0
+	}
+	z.add(zmemberCost(member))
+	return 1
+}
+
+// ZScore 返回成员的分数
+func (z *SortedSet) ZScore(key string, member []byte) (float64, bool) {
+	if !z.exist(key) {
+		return 0, false
+	}
+	score, exist := z.record[key].dict[string(member)]
+	return score, exist
+}
+
+// ZIncrBy 增加成员的分数, 成员不存在时以0为初始分数, 返回新的分数
+func (z *SortedSet) ZIncrBy(key string, increment float64, member []byte) float64 {
+	score, _ := z.ZScore(key, member)
+	score += increment
+	z.ZAdd(key, score, member)
+	return score
+}
+
+// ZRem 删除成员, 返回被删除成员的数量
+func (z *SortedSet) ZRem(key string, member []byte) int {
+	score, exist := z.ZScore(key, member)
+	if !exist {
+		return 0
+	}
+
+	item := z.record[key]
+	delete(item.dict, string(member))
+	item.skl.Remove(zslKey(score, member))
+	z.add(-zmemberCost(member))
+
+	// 成员为空时删除整个键
+	if len(item.dict) == 0 {
+		delete(z.record, key)
+		z.add(-(len(key) + keyOverhead))
+	}
+	return 1
+}
+
+// ZCard 返回成员数量
+func (z *SortedSet) ZCard(key string) int {
+	if !z.exist(key) {
+		return 0
+	}
+	return len(z.record[key].dict)
+}
+
+// ZRank 返回成员按分数从小到大的排名, 从0开始
+func (z *SortedSet) ZRank(key string, member []byte) (int, bool) {
+	score, exist := z.ZScore(key, member)
+	if !exist {
+		return 0, false
+	}
+
+	target := string(zslKey(score, member))
+	rank := 0
+	for p := z.record[key].skl.Front(); p != nil; p = p.Next() {
+		if string(p.Key()) == target {
+			break
+		}
+		rank++
+	}
+	return rank, true
+}
+
+// ZRange 返回排名在[start, stop]之间的成员, 下标可以为负数
+func (z *SortedSet) ZRange(key string, start, stop int) (res [][]byte) {
+	if !z.exist(key) {
+		return nil
+	}
+
+	item := z.record[key]
+	start, stop = handleIndex(len(item.dict), start, stop)
+
+	i := 0
+	for p := item.skl.Front(); p != nil && i <= stop; p, i = p.Next(), i+1 {
+		if i >= start {
+			res = append(res, p.Value().([]byte))
+		}
+	}
+	return
+}
+
+// ZRangeByScore 返回分数在[min, max]之间的成员
+func (z *SortedSet) ZRangeByScore(key string, min, max float64) (res [][]byte) {
+	if !z.exist(key) || min > max {
+		return nil
+	}
+
+	item := z.record[key]
+	for p := item.skl.Seek(zslKey(min, nil)); p != nil; p = p.Next() {
+		member := p.Value().([]byte)
+		if item.dict[string(member)] > max {
+			break
+		}
+		res = append(res, member)
+	}
+	return
+}
+
+// ZKeyExists 判断键是否存在
+func (z *SortedSet) ZKeyExists(key string) bool {
+	return z.exist(key)
+}
+
+func (z *SortedSet) exist(key string) bool {
+	_, exist := z.record[key]
+	return exist
+}
+
+// 成员占用的内存估计, 成员同时保存在字典和跳跃表中
+func zmemberCost(member []byte) int {
+	return 2 * (len(member) + elementOverhead)
+}
+
+// 由分数和成员拼接跳跃表的键, 分数编码后按字节序比较的结果与数值大小一致
+func zslKey(score float64, member []byte) []byte {
+	bits := math.Float64bits(score)
+	if score >= 0 {
+		bits |= 1 << 63
+	} else {
+		bits = ^bits
+	}
+
+	key := make([]byte, 8+len(member))
+	binary.BigEndian.PutUint64(key[:8], bits)
+	copy(key[8:], member)
+	return key
+}
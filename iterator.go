@@ -0,0 +1,292 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"kvstore/index"
+)
+
+// ErrIteratorClosed 迭代器已经关闭
+var ErrIteratorClosed = errors.New("kvstore: iterator is closed")
+
+// IteratorOptions 迭代器配置
+type IteratorOptions struct {
+	// Prefix 只遍历带有该前缀的键
+	Prefix []byte
+	// Start 遍历区间的起始键(包含), 为空表示没有下界
+	Start []byte
+	// End 遍历区间的结束键(不包含), 为空表示没有上界
+	End []byte
+	// Reverse 是否按键从大到小遍历
+	Reverse bool
+}
+
+// Iterator 字符串索引表的迭代器
+// 迭代器只记录当前的键, 每次移动时在读锁保护下重新定位, 因此不会长时间阻塞写入,
+// 并发写入的键是否可见取决于其与当前位置的先后关系
+type Iterator struct {
+	kv     *Kvstore
+	snap   *Snapshot
+	opts   IteratorOptions
+	key    []byte
+	value  []byte
+	valid  bool
+	closed bool
+	err    error
+}
+
+// NewIterator 建立迭代器, 并定位到第一个满足条件的键
+func (k *Kvstore) NewIterator(opts IteratorOptions) *Iterator {
+	it := &Iterator{kv: k, opts: opts}
+	it.Rewind()
+	return it
+}
+
+// Rewind 定位到第一个满足条件的键, 逆序时为最后一个
+func (it *Iterator) Rewind() {
+	if it.closed {
+		return
+	}
+	if it.opts.Reverse {
+		it.backward(it.upper(), false)
+	} else {
+		it.forward(it.lower(), true)
+	}
+}
+
+// Seek 顺序时定位到第一个大于等于key的键, 逆序时定位到最后一个小于等于key的键
+func (it *Iterator) Seek(key []byte) {
+	if it.closed {
+		return
+	}
+	if it.opts.Reverse {
+		upper := it.upper()
+		if upper != nil && bytes.Compare(key, upper) >= 0 {
+			it.backward(upper, false)
+		} else {
+			it.backward(key, true)
+		}
+	} else {
+		if lower := it.lower(); bytes.Compare(key, lower) < 0 {
+			key = lower
+		}
+		it.forward(key, true)
+	}
+}
+
+// Next 移动到下一个键, 逆序时向更小的键移动
+func (it *Iterator) Next() {
+	if !it.Valid() {
+		return
+	}
+	if it.opts.Reverse {
+		it.backward(it.key, false)
+	} else {
+		it.forward(it.key, false)
+	}
+}
+
+// Prev 移动到上一个键, 逆序时向更大的键移动
+func (it *Iterator) Prev() {
+	if !it.Valid() {
+		return
+	}
+	if it.opts.Reverse {
+		it.forward(it.key, false)
+	} else {
+		it.backward(it.key, false)
+	}
+}
+
+// Valid 判断当前位置是否有效
+func (it *Iterator) Valid() bool {
+	return !it.closed && it.valid
+}
+
+// Key 返回当前位置的键
+func (it *Iterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.key
+}
+
+// Value 返回当前位置的值
+func (it *Iterator) Value() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.value
+}
+
+// Err 返回迭代过程中读取数据发生的错误
+func (it *Iterator) Err() error {
+	if it.closed {
+		return ErrIteratorClosed
+	}
+	return it.err
+}
+
+// Close 关闭迭代器
+func (it *Iterator) Close() {
+	it.closed = true
+	it.valid = false
+	it.key, it.value = nil, nil
+}
+
+// 向更大的键移动, inclusive表示是否包含from本身
+func (it *Iterator) forward(from []byte, inclusive bool) {
+	k := it.kv
+	k.strIndex.mu.RLock()
+	defer k.strIndex.mu.RUnlock()
+
+	if it.snap != nil && it.snap.closed {
+		it.err, it.valid = ErrSnapshotClosed, false
+		return
+	}
+
+	if !inclusive {
+		from = successor(from)
+	}
+	for key := it.seekKey(from); key != nil && it.inRange(key); key = it.seekKey(successor(key)) {
+		if idx := it.lookup(key); idx != nil {
+			it.load(key, idx)
+			return
+		}
+	}
+	it.valid = false
+}
+
+// 向更小的键移动, inclusive表示是否包含from本身, from为空表示从最后一个键开始
+func (it *Iterator) backward(from []byte, inclusive bool) {
+	k := it.kv
+	k.strIndex.mu.RLock()
+	defer k.strIndex.mu.RUnlock()
+
+	if it.snap != nil && it.snap.closed {
+		it.err, it.valid = ErrSnapshotClosed, false
+		return
+	}
+
+	if from != nil && inclusive {
+		from = successor(from)
+	}
+	for key := it.seekKeyBefore(from); key != nil && it.inRange(key); key = it.seekKeyBefore(key) {
+		if idx := it.lookup(key); idx != nil {
+			it.load(key, idx)
+			return
+		}
+	}
+	it.valid = false
+}
+
+// 查找第一个大于等于from的键, 快照迭代器还需要查找只存在于历史版本中的键
+func (it *Iterator) seekKey(from []byte) []byte {
+	var key []byte
+	iter := it.kv.strIndex.index.Iterator()
+	if iter.Seek(from); iter.Valid() {
+		key = iter.Key()
+	}
+	if it.snap != nil {
+		if node := it.kv.strIndex.history.Seek(from); node != nil && (key == nil || bytes.Compare(node.Key(), key) < 0) {
+			key = node.Key()
+		}
+	}
+	return key
+}
+
+// 查找最后一个小于from的键, from为空表示查找最后一个键
+func (it *Iterator) seekKeyBefore(from []byte) []byte {
+	find := func(skl *index.SkipList) *index.Node {
+		if from == nil {
+			return skl.Back()
+		}
+		return skl.SeekBefore(from)
+	}
+
+	var key []byte
+	iter := it.kv.strIndex.index.Iterator()
+	if iter.SeekBefore(from); iter.Valid() {
+		key = iter.Key()
+	}
+	if it.snap != nil {
+		if node := find(it.kv.strIndex.history); node != nil && bytes.Compare(node.Key(), key) > 0 {
+			key = node.Key()
+		}
+	}
+	return key
+}
+
+// 查找键对应的索引信息, 不存在或已过期时返回空
+func (it *Iterator) lookup(key []byte) *index.Indexer {
+	if it.snap != nil {
+		return it.snap.lookup(key)
+	}
+	idx := it.kv.strIndex.index.Get(key)
+	if idx == nil || it.kv.expired(key) {
+		return nil
+	}
+	return idx
+}
+
+// 读取键值, 调用方需持有字符串索引表的锁
+func (it *Iterator) load(key []byte, idx *index.Indexer) {
+	value, err := it.kv.getValue(idx)
+	if err != nil {
+		it.err = err
+		it.valid = false
+		return
+	}
+	it.key = append(it.key[:0], key...)
+	it.value = value
+	it.valid = true
+}
+
+// 判断键是否在遍历范围内
+func (it *Iterator) inRange(key []byte) bool {
+	if !bytes.HasPrefix(key, it.opts.Prefix) {
+		return false
+	}
+	if it.opts.Start != nil && bytes.Compare(key, it.opts.Start) < 0 {
+		return false
+	}
+	if it.opts.End != nil && bytes.Compare(key, it.opts.End) >= 0 {
+		return false
+	}
+	return true
+}
+
+// 遍历范围的下界(包含)
+func (it *Iterator) lower() []byte {
+	lower := it.opts.Prefix
+	if bytes.Compare(it.opts.Start, lower) > 0 {
+		lower = it.opts.Start
+	}
+	return lower
+}
+
+// 遍历范围的上界(不包含), 为空表示没有上界
+func (it *Iterator) upper() []byte {
+	upper := prefixEnd(it.opts.Prefix)
+	if it.opts.End != nil && (upper == nil || bytes.Compare(it.opts.End, upper) < 0) {
+		upper = it.opts.End
+	}
+	return upper
+}
+
+// 返回大于key的最小键
+func successor(key []byte) []byte {
+	return append(append([]byte{}, key...), 0)
+}
+
+// 返回大于所有带有该前缀的键的最小键, 不存在时返回空
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package kvstore
+
+import (
+	"bytes"
+	"kvstore/index"
+	"kvstore/store"
+	"sync"
+)
+
+type HashIdx struct {
+	indexes *index.Hash
+	mu      sync.RWMutex
+}
+
+// NewHashIdx 建立哈希索引表
+func NewHashIdx() *HashIdx {
+	return &HashIdx{indexes: index.NewHash()}
+}
+
+// HSet 设置哈希表中字段的值, 返回新增字段的数量
+func (k *Kvstore) HSet(key, field, value []byte) (res int, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, field, value); err != nil {
+		return
+	}
+	// 内存不足时按照淘汰策略淘汰字符串键
+	if err = k.reserveMemory(index.Cost(key, field, value)); err != nil {
+		return
+	}
+
+	// 加锁
+	k.hashIndex.mu.Lock()
+	defer k.hashIndex.mu.Unlock()
+
+	// 值没有变化则不需要写入文件
+	old := k.hashIndex.indexes.HGet(string(key), string(field))
+	if old != nil && bytes.Equal(old, value) {
+		return
+	}
+
+	// 封装entry, 字段写入额外信息
+	e := store.NewEntry(key, value, field, Hash, HashHSet)
+	if err = k.store(e); err != nil {
+		return
+	}
+
+	// 更新索引表
+	res = k.hashIndex.indexes.HSet(string(key), string(field), value)
+	return
+}
+
+// HGet 获取哈希表中字段的值
+func (k *Kvstore) HGet(key, field []byte) ([]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.hashIndex.mu.RLock()
+	defer k.hashIndex.mu.RUnlock()
+
+	return k.hashIndex.indexes.HGet(string(key), string(field)), nil
+}
+
+// HDel 删除哈希表中的字段, 返回被删除字段的数量
+func (k *Kvstore) HDel(key []byte, fields ...[]byte) (res int, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, nil); err != nil {
+		return
+	}
+
+	// 加锁
+	k.hashIndex.mu.Lock()
+	defer k.hashIndex.mu.Unlock()
+
+	for _, field := range fields {
+		// 字段不存在则跳过
+		if !k.hashIndex.indexes.HExists(string(key), string(field)) {
+			continue
+		}
+
+		// 封装entry, 然后写入文件
+		e := store.NewEntry(key, nil, field, Hash, HashHDel)
+		if err = k.store(e); err != nil {
+			return
+		}
+
+		// 更新索引表
+		res += k.hashIndex.indexes.HDel(string(key), string(field))
+	}
+	return
+}
+
+// HGetAll 返回哈希表中所有的字段和值
+func (k *Kvstore) HGetAll(key []byte) ([][]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.hashIndex.mu.RLock()
+	defer k.hashIndex.mu.RUnlock()
+
+	return k.hashIndex.indexes.HGetAll(string(key)), nil
+}
+
+// HLen 返回哈希表中字段的数量
+func (k *Kvstore) HLen(key []byte) int {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return 0
+	}
+
+	// 加锁
+	k.hashIndex.mu.RLock()
+	defer k.hashIndex.mu.RUnlock()
+
+	return k.hashIndex.indexes.HLen(string(key))
+}
+
+// HExists 判断哈希表中字段是否存在
+func (k *Kvstore) HExists(key, field []byte) bool {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return false
+	}
+
+	// 加锁
+	k.hashIndex.mu.RLock()
+	defer k.hashIndex.mu.RUnlock()
+
+	return k.hashIndex.indexes.HExists(string(key), string(field))
+}
@@ -0,0 +1,29 @@
+package kvstore
+
+import (
+	"testing"
+)
+
+func TestHashEmptyValueRewrite(t *testing.T) {
+	config := testConfig(t)
+	kv := openTestKv(t, config)
+	if _, err := kv.HSet([]byte("k"), []byte("f"), []byte("")); err != nil {
+		t.Fatal(err)
+	}
+	fillArchFiles(t, kv, 100)
+
+	// 重放之后空值为nil, 重写和合并都不能把它当作已删除的字段
+	kv = reopenTestKv(t, kv, config)
+	if err := kv.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	kv = reopenTestKv(t, kv, config)
+	if err := kv.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	kv = reopenTestKv(t, kv, config)
+	defer kv.Close()
+	if !kv.HExists([]byte("k"), []byte("f")) {
+		t.Fatal("empty field value lost")
+	}
+}
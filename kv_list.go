@@ -0,0 +1,242 @@
+package kvstore
+
+import (
+	"kvstore/index"
+	"kvstore/store"
+	"strconv"
+	"sync"
+)
+
+type ListIdx struct {
+	indexes *index.List
+	mu      sync.RWMutex
+}
+
+// NewListIdx 建立列表索引表
+func NewListIdx() *ListIdx {
+	return &ListIdx{indexes: index.NewList()}
+}
+
+// LPush 在列表头部插入元素, 返回列表长度
+func (k *Kvstore) LPush(key []byte, values ...[]byte) (int, error) {
+	return k.push(key, ListLPush, values...)
+}
+
+// RPush 在列表尾部插入元素, 返回列表长度
+func (k *Kvstore) RPush(key []byte, values ...[]byte) (int, error) {
+	return k.push(key, ListRPush, values...)
+}
+
+// LPop 弹出列表头部元素
+func (k *Kvstore) LPop(key []byte) ([]byte, error) {
+	return k.pop(key, ListLPop)
+}
+
+// RPop 弹出列表尾部元素
+func (k *Kvstore) RPop(key []byte) ([]byte, error) {
+	return k.pop(key, ListRPop)
+}
+
+// LIndex 返回列表中下标对应的元素
+func (k *Kvstore) LIndex(key []byte, idx int) ([]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.listIndex.mu.RLock()
+	defer k.listIndex.mu.RUnlock()
+
+	// 空元素返回空切片, 与下标越界的nil区分
+	value, ok := k.listIndex.indexes.LIndex(string(key), idx)
+	if ok && value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
+
+// LSet 设置列表中下标对应元素的值
+func (k *Kvstore) LSet(key []byte, idx int, value []byte) error {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, value); err != nil {
+		return err
+	}
+	// 内存不足时按照淘汰策略淘汰字符串键
+	if err := k.reserveMemory(index.Cost(key, value)); err != nil {
+		return err
+	}
+
+	// 加锁
+	k.listIndex.mu.Lock()
+	defer k.listIndex.mu.Unlock()
+
+	// 判断键和下标是否存在
+	if !k.listIndex.indexes.LKeyExists(string(key)) {
+		return ErrKeyNotExist
+	}
+	if _, ok := k.listIndex.indexes.LIndex(string(key), idx); !ok {
+		return ErrIndexOutOfRange
+	}
+
+	// 封装entry, 下标写入额外信息
+	e := store.NewEntry(key, value, []byte(strconv.Itoa(idx)), List, ListLSet)
+	if err := k.store(e); err != nil {
+		return err
+	}
+
+	// 更新索引表
+	k.listIndex.indexes.LSet(string(key), idx, value)
+	return nil
+}
+
+// LLen 返回列表长度
+func (k *Kvstore) LLen(key []byte) int {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return 0
+	}
+
+	// 加锁
+	k.listIndex.mu.RLock()
+	defer k.listIndex.mu.RUnlock()
+
+	return k.listIndex.indexes.LLen(string(key))
+}
+
+// LRem 删除列表中与value相等的元素, 返回删除的数量
+func (k *Kvstore) LRem(key, value []byte, count int) (res int, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, value); err != nil {
+		return
+	}
+
+	// 加锁
+	k.listIndex.mu.Lock()
+	defer k.listIndex.mu.Unlock()
+
+	if !k.listIndex.indexes.LKeyExists(string(key)) {
+		return
+	}
+
+	// 封装entry, 删除数量写入额外信息
+	e := store.NewEntry(key, value, []byte(strconv.Itoa(count)), List, ListLRem)
+	if err = k.store(e); err != nil {
+		return
+	}
+
+	// 更新索引表
+	res = k.listIndex.indexes.LRem(string(key), value, count)
+	return
+}
+
+// LTrim 只保留列表中下标在[start, end]之间的元素
+func (k *Kvstore) LTrim(key []byte, start, end int) error {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+
+	// 加锁
+	k.listIndex.mu.Lock()
+	defer k.listIndex.mu.Unlock()
+
+	if !k.listIndex.indexes.LKeyExists(string(key)) {
+		return nil
+	}
+
+	// 封装entry, 区间写入额外信息
+	extra := strconv.Itoa(start) + ExtraSeparator + strconv.Itoa(end)
+	e := store.NewEntry(key, nil, []byte(extra), List, ListLTrim)
+	if err := k.store(e); err != nil {
+		return err
+	}
+
+	// 更新索引表
+	k.listIndex.indexes.LTrim(string(key), start, end)
+	return nil
+}
+
+// LRange 返回列表中下标在[start, end]之间的元素
+func (k *Kvstore) LRange(key []byte, start, end int) ([][]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.listIndex.mu.RLock()
+	defer k.listIndex.mu.RUnlock()
+
+	return k.listIndex.indexes.LRange(string(key), start, end), nil
+}
+
+// 插入元素并写入文件
+func (k *Kvstore) push(key []byte, opt uint16, values ...[]byte) (res int, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, values...); err != nil {
+		return
+	}
+	// 内存不足时按照淘汰策略淘汰字符串键
+	if err = k.reserveMemory(index.Cost(key, values...)); err != nil {
+		return
+	}
+
+	// 加锁
+	k.listIndex.mu.Lock()
+	defer k.listIndex.mu.Unlock()
+
+	for _, v := range values {
+		// 封装entry, 然后写入文件
+		e := store.NewNoExtraEntry(key, v, List, opt)
+		if err = k.store(e); err != nil {
+			return
+		}
+
+		// 更新索引表
+		if opt == ListLPush {
+			res = k.listIndex.indexes.LPush(string(key), v)
+		} else {
+			res = k.listIndex.indexes.RPush(string(key), v)
+		}
+	}
+	return
+}
+
+// 弹出元素并写入文件
+func (k *Kvstore) pop(key []byte, opt uint16) ([]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.listIndex.mu.Lock()
+	defer k.listIndex.mu.Unlock()
+
+	if !k.listIndex.indexes.LKeyExists(string(key)) {
+		return nil, nil
+	}
+
+	// 封装entry, 然后写入文件
+	e := store.NewNoExtraEntry(key, nil, List, opt)
+	if err := k.store(e); err != nil {
+		return nil, err
+	}
+
+	// 更新索引表
+	if opt == ListLPop {
+		return k.listIndex.indexes.LPop(string(key)), nil
+	}
+	return k.listIndex.indexes.RPop(string(key)), nil
+}
+
+// 将所有列表的当前内容封装成entry, 用于重写数据库文件, 调用方需持有列表索引表的锁
+func (k *Kvstore) listEntries() (entries []*store.Entry) {
+	for _, key := range k.listIndex.indexes.Keys() {
+		for _, v := range k.listIndex.indexes.LRange(key, 0, -1) {
+			e := store.NewNoExtraEntry([]byte(key), v, List, ListRPush)
+			entries = append(entries, e)
+		}
+	}
+	return
+}
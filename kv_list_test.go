@@ -0,0 +1,29 @@
+package kvstore
+
+import (
+	"testing"
+)
+
+func TestListSetEmptyElement(t *testing.T) {
+	config := testConfig(t)
+	kv := openTestKv(t, config)
+	if _, err := kv.RPush([]byte("k"), []byte("a"), []byte(""), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重放之后空元素为nil, 不能被当作下标越界
+	kv = reopenTestKv(t, kv, config)
+	defer kv.Close()
+	if v, err := kv.LIndex([]byte("k"), 1); err != nil || v == nil || len(v) != 0 {
+		t.Fatalf("lindex: got %q, %v, want empty element", v, err)
+	}
+	if err := kv.LSet([]byte("k"), 1, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := kv.LIndex([]byte("k"), 1); string(v) != "b" {
+		t.Fatalf("lindex after lset: got %q, want %q", v, "b")
+	}
+	if err := kv.LSet([]byte("k"), 3, []byte("d")); err != ErrIndexOutOfRange {
+		t.Fatalf("lset out of range: got %v, want %v", err, ErrIndexOutOfRange)
+	}
+}
@@ -0,0 +1,196 @@
+package kvstore
+
+import (
+	"kvstore/index"
+	"kvstore/store"
+	"sync"
+)
+
+type SetIdx struct {
+	indexes *index.Set
+	mu      sync.RWMutex
+}
+
+// NewSetIdx 建立集合索引表
+func NewSetIdx() *SetIdx {
+	return &SetIdx{indexes: index.NewSet()}
+}
+
+// SAdd 向集合中添加成员, 返回新增成员的数量
+func (k *Kvstore) SAdd(key []byte, members ...[]byte) (res int, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, members...); err != nil {
+		return
+	}
+	// 内存不足时按照淘汰策略淘汰字符串键
+	if err = k.reserveMemory(index.Cost(key, members...)); err != nil {
+		return
+	}
+
+	// 加锁
+	k.setIndex.mu.Lock()
+	defer k.setIndex.mu.Unlock()
+
+	for _, m := range members {
+		// 成员已经存在则跳过
+		if k.setIndex.indexes.SIsMember(string(key), m) {
+			continue
+		}
+
+		// 封装entry, 然后写入文件
+		e := store.NewNoExtraEntry(key, m, Set, SetSAdd)
+		if err = k.store(e); err != nil {
+			return
+		}
+
+		// 更新索引表
+		res += k.setIndex.indexes.SAdd(string(key), m)
+	}
+	return
+}
+
+// SRem 删除集合中的成员, 返回被删除成员的数量
+func (k *Kvstore) SRem(key []byte, members ...[]byte) (res int, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, members...); err != nil {
+		return
+	}
+
+	// 加锁
+	k.setIndex.mu.Lock()
+	defer k.setIndex.mu.Unlock()
+
+	for _, m := range members {
+		var n int
+		if n, err = k.srem(key, m); err != nil {
+			return
+		}
+		res += n
+	}
+	return
+}
+
+// SPop 随机删除并返回集合中的count个成员
+func (k *Kvstore) SPop(key []byte, count int) (res [][]byte, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, nil); err != nil {
+		return
+	}
+
+	// 加锁
+	k.setIndex.mu.Lock()
+	defer k.setIndex.mu.Unlock()
+
+	// 随机选出的成员以删除操作写入文件, 保证重放结果一致
+	for _, m := range k.setIndex.indexes.SRandMember(string(key), count) {
+		if _, err = k.srem(key, m); err != nil {
+			return
+		}
+		res = append(res, m)
+	}
+	return
+}
+
+// SIsMember 判断是否为集合中的成员
+func (k *Kvstore) SIsMember(key, member []byte) bool {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return false
+	}
+
+	// 加锁
+	k.setIndex.mu.RLock()
+	defer k.setIndex.mu.RUnlock()
+
+	return k.setIndex.indexes.SIsMember(string(key), member)
+}
+
+// SMembers 返回集合中的所有成员
+func (k *Kvstore) SMembers(key []byte) ([][]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.setIndex.mu.RLock()
+	defer k.setIndex.mu.RUnlock()
+
+	return k.setIndex.indexes.SMembers(string(key)), nil
+}
+
+// SCard 返回集合中成员的数量
+func (k *Kvstore) SCard(key []byte) int {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return 0
+	}
+
+	// 加锁
+	k.setIndex.mu.RLock()
+	defer k.setIndex.mu.RUnlock()
+
+	return k.setIndex.indexes.SCard(string(key))
+}
+
+// SRandMember 随机返回集合中的count个成员
+func (k *Kvstore) SRandMember(key []byte, count int) ([][]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.setIndex.mu.RLock()
+	defer k.setIndex.mu.RUnlock()
+
+	return k.setIndex.indexes.SRandMember(string(key), count), nil
+}
+
+// SUnion 返回多个集合的并集
+func (k *Kvstore) SUnion(keys ...[]byte) ([][]byte, error) {
+	return k.setAlgebra(k.setIndex.indexes.SUnion, keys...)
+}
+
+// SInter 返回多个集合的交集
+func (k *Kvstore) SInter(keys ...[]byte) ([][]byte, error) {
+	return k.setAlgebra(k.setIndex.indexes.SInter, keys...)
+}
+
+// SDiff 返回第一个集合与其余集合的差集
+func (k *Kvstore) SDiff(keys ...[]byte) ([][]byte, error) {
+	return k.setAlgebra(k.setIndex.indexes.SDiff, keys...)
+}
+
+// 删除成员并写入文件, 返回被删除成员的数量, 调用方需持有集合索引表的锁
+func (k *Kvstore) srem(key, member []byte) (int, error) {
+	// 成员不存在则跳过
+	if !k.setIndex.indexes.SIsMember(string(key), member) {
+		return 0, nil
+	}
+
+	// 封装entry, 然后写入文件
+	e := store.NewNoExtraEntry(key, member, Set, SetSRem)
+	if err := k.store(e); err != nil {
+		return 0, err
+	}
+
+	// 更新索引表
+	return k.setIndex.indexes.SRem(string(key), member), nil
+}
+
+// 集合运算统一接口
+func (k *Kvstore) setAlgebra(op func(...string) [][]byte, keys ...[]byte) ([][]byte, error) {
+	var names []string
+	for _, key := range keys {
+		// 检查数据是否合法
+		if err := k.checkKeyValue(key, nil); err != nil {
+			return nil, err
+		}
+		names = append(names, string(key))
+	}
+
+	// 加锁
+	k.setIndex.mu.RLock()
+	defer k.setIndex.mu.RUnlock()
+
+	return op(names...), nil
+}
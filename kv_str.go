@@ -2,20 +2,49 @@ package kvstore
 
 import (
 	"kvstore/index"
+	"math"
 	"kvstore/store"
 	"log"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type StrIdx struct {
-	skl *index.SkipList
+	// 写操作的计数, 持有写锁期间为奇数, 64位原子操作的字段放在开头保证对齐
+	// 不加锁的读操作前后读到的计数一致时, 说明读取期间没有写操作
+	writes uint64
+	index index.Index
 	mu  sync.RWMutex
+	// 当前版本号, 每次修改键时加一
+	seq uint64
+	// 打开的快照
+	snapshots map[*Snapshot]struct{}
+	// 被快照引用的历史版本, 键 -> []*strVersion
+	history *index.SkipList
+	// 磁盘索引表已经包含的写入位置, 只在启动重放期间有效
+	checkpoint *index.Checkpoint
 }
 
 // NewStrIdx 建立字符串索引表
-func NewStrIdx() *StrIdx {
-	return &StrIdx{skl: index.InitSkl()}
+func NewStrIdx(t index.Type) *StrIdx {
+	return &StrIdx{
+		index: index.NewIndex(t),
+		snapshots: make(map[*Snapshot]struct{}),
+		history: index.InitSkl(),
+	}
+}
+
+// 加写锁, 同时使不加锁的读操作能够发现写操作
+func (s *StrIdx) lock() {
+	s.mu.Lock()
+	atomic.AddUint64(&s.writes, 1)
+}
+
+func (s *StrIdx) unlock() {
+	atomic.AddUint64(&s.writes, 1)
+	s.mu.Unlock()
 }
 
 // Set 设置str值
@@ -26,20 +55,81 @@ func (k *Kvstore) Set(key []byte, value []byte) error {
 	}
 
 	// 加锁
-	k.strIndex.mu.Lock()
-	defer k.strIndex.mu.Unlock()
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	defer k.flushIndex()
 
-	elem := k.strIndex.skl.Find(key)
-	if elem == nil {
-		err := k.doSet(key, value)
+	// 内存不足时按照淘汰策略淘汰其他键
+	if err := k.freeMemory(store.NewNoExtraEntry(key, value, String, StringSet)); err != nil {
 		return err
 	}
-	if _, ok := k.expires[string(key)]; ok {
-		// 删除过期键
-		delete(k.expires, string(key))
+
+	// 写入文件并更新索引表, 已经存在的键直接覆盖, 同时删除过期时间
+	k.saveVersion(key)
+	return k.doSet(key, value, 0)
+}
+
+// SetOptions 设置字符串时的可选参数
+type SetOptions struct {
+	// TTL 存活时间, 精确到毫秒, 为0表示不设置过期时间
+	TTL time.Duration
+	// NX 只在键不存在时设置
+	NX bool
+	// XX 只在键已经存在时设置
+	XX bool
+	// KeepTTL 保留键原来的过期时间
+	KeepTTL bool
+}
+
+// SetWithOptions 根据可选参数设置str值, NX或XX的条件不满足时不设置并返回false
+func (k *Kvstore) SetWithOptions(key, value []byte, opts SetOptions) (bool, error) {
+	//检查数据是否合法
+	if err := k.checkKeyValue(key, value); err != nil {
+		return false, err
+	}
+	if (opts.NX && opts.XX) || (opts.TTL != 0 && opts.KeepTTL) {
+		return false, ErrInvalidSetOptions
 	}
-	return nil
+	if opts.TTL < 0 || (opts.TTL > 0 && opts.TTL < time.Millisecond) {
+		return false, ErrInvalidExpireTime
+	}
+
+	// 加锁
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	defer k.flushIndex()
+
+	// 已经过期的键视为不存在
+	exist := k.strIndex.index.Get(key) != nil && !k.expired(key)
+	if (opts.NX && exist) || (opts.XX && !exist) {
+		return false, nil
+	}
+
+	var deadline uint64
+	if opts.TTL > 0 {
+		ms := uint64(opts.TTL / time.Millisecond)
+		now := k.now()
+		if ms > math.MaxUint64-now {
+			return false, ErrInvalidExpireTime
+		}
+		deadline = now + ms
+	} else if opts.KeepTTL && exist {
+		deadline = k.expires[string(key)]
+	}
+
+	// 内存不足时按照淘汰策略淘汰其他键
+	if err := k.freeMemory(store.NewNoExtraEntry(key, value, String, StringSet)); err != nil {
+		return false, err
+	}
+
+	// 写入文件并更新索引表
+	k.saveVersion(key)
+	if err := k.doSet(key, value, deadline); err != nil {
+		return false, err
+	}
+	return true, nil
 }
+
 // Get 获取str数据
 func (k *Kvstore) Get(key []byte) ([]byte, error) {
 	// 判断key是否合法
@@ -47,116 +137,279 @@ func (k *Kvstore) Get(key []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	// 跳跃表的查询不需要加锁, 读取期间没有写操作时直接返回
+	if value, ok, err := k.getLockFree(key); ok {
+		return value, err
+	}
+
 	expire := k.isExpired(key)
 
 	// 根据是否过期来选择加不同的锁
 	if expire {
-		k.strIndex.mu.Lock()
-		defer k.strIndex.mu.Unlock()
+		k.strIndex.lock()
+		defer k.strIndex.unlock()
+		defer k.flushIndex()
 	} else {
 		k.strIndex.mu.RLock()
 		defer k.strIndex.mu.RUnlock()
 	}
 
-	if expire {
-		delete(k.expires, string(key))
-		ele := k.strIndex.skl.Find(key)
-		if ele == nil {
-			return nil, ErrKeyNotExist
-		}
-		e := store.NewNoExtraEntry(key, nil, String, StringRem)
-		if err := k.store(e); err != nil {
+	// 加写锁之前键可能已经被修改, 需要重新判断
+	if expire && k.expired(key) {
+		if err := k.removeExpired(key); err != nil {
 			log.Printf("remove expires %s, %s\n", key, err.Error())
 		}
 		return nil, ErrKeyNotExist
 	}
 
 	// 从索引表获取数据
-	element := k.strIndex.skl.Find(key)
-	if element == nil {
+	idx := k.strIndex.index.Get(key)
+	if idx == nil {
 		return nil, ErrKeyNotExist
 	}
+	k.touchKey(key)
 
-	// 类型断言
-	idx := element.Value().(*index.Indexer)
-	if idx == nil {
-		return nil, ErrNilIndexer
-	}
+	// 返回
+	return k.getValue(idx)
+}
 
+// 根据索引信息获取值, 调用方需持有字符串索引表的锁
+func (k *Kvstore) getValue(idx *index.Indexer) ([]byte, error) {
 	// 键值都存在内存中
 	if k.config.IdxMode == KeyValueMode {
 		return idx.Meta.Value, nil
 	}
 
-	// 只有键存在内存中, 则需要到磁盘中寻找
-	if k.config.IdxMode == OnlyKeyMode {
-		kf := k.activeFile
-		if idx.FileId != kf.Id {
-			kf = k.archFiles[idx.FileId]
+	// 只有键存在索引表中, 则需要到磁盘中寻找
+	if k.config.IdxMode == OnlyKeyMode || k.config.IdxMode == DiskIndexMode {
+		// 先查找值缓存
+		if v, ok := k.cachedValue(idx); ok {
+			return v, nil
 		}
 
-		e, err := kf.Read(idx.Offset)
-		if err != nil {
-			return nil, err
-		}
-		return e.Meta.Value, nil
+		k.mu.RLock()
+		defer k.mu.RUnlock()
+		return k.readValue(idx)
 	}
 
 	// 返回
 	return nil, ErrKeyNotExist
 }
 
+// 从文件读取值并放入值缓存, 调用方需持有k.mu
+func (k *Kvstore) readValue(idx *index.Indexer) ([]byte, error) {
+	kf := k.activeFile
+	if idx.FileId != kf.Id {
+		kf = k.archFiles[idx.FileId]
+	}
+
+	e, err := kf.Read(idx.Offset)
+	if err != nil {
+		return nil, err
+	}
+	k.cacheValue(idx, e.Meta.Value)
+	return e.Meta.Value, nil
+}
+
+// 不加字符串索引表的锁读取, 只有跳跃表支持查询与修改同时执行
+// 读取期间有写操作或者键已经过期时返回false, 由调用方加锁重新读取
+func (k *Kvstore) getLockFree(key []byte) ([]byte, bool, error) {
+	s := k.strIndex
+	if !index.LockFreeGet(s.index) {
+		return nil, false, nil
+	}
+	writes := atomic.LoadUint64(&s.writes)
+	unchanged := func() bool {
+		return atomic.LoadUint64(&s.writes) == writes
+	}
+	// 过期的键需要加写锁删除
+	if writes%2 == 1 || k.expiredLockFree(key) {
+		return nil, false, nil
+	}
+
+	idx := s.index.Get(key)
+	if idx == nil || k.config.IdxMode == KeyValueMode {
+		var value []byte
+		if idx != nil {
+			value = idx.Meta.Value
+		}
+		if !unchanged() {
+			return nil, false, nil
+		}
+		if idx == nil {
+			return nil, true, ErrKeyNotExist
+		}
+		k.touchKey(key)
+		return value, true, nil
+	}
+
+	// 合并和重写需要先加写锁再移动或删除文件, 持有k.mu之后计数仍然不变时索引信息指向的文件有效
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if !unchanged() {
+		return nil, false, nil
+	}
+	value, ok := k.cachedValue(idx)
+	if !ok {
+		var err error
+		if value, err = k.readValue(idx); err != nil {
+			return nil, true, err
+		}
+	}
+	k.touchKey(key)
+	return value, true, nil
+}
+
 // StrRem 根据给定的key删除索引表中的数据
 func (k *Kvstore) StrRem(key []byte) error {
+	_, err := k.StrRemExist(key)
+	return err
+}
+
+// StrRemExist 删除key, 返回删除之前key是否存在, 已经过期的键视为不存在
+func (k *Kvstore) StrRemExist(key []byte) (bool, error) {
 	// 检查数据是否合法
 	if err := k.checkKeyValue(key, nil); err != nil {
-		return err
+		return false, err
 	}
 	// 加锁
-	k.strIndex.mu.Lock()
-	defer k.strIndex.mu.Unlock()
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	defer k.flushIndex()
+
+	if k.strIndex.index.Get(key) == nil {
+		return false, nil
+	}
+	exist := !k.expired(key)
 
 	// 删除操作
-	if item := k.strIndex.skl.Remove(key); item != nil {
-		// 过期字典处理
-		delete(k.expires, string(key))
-		// 封装entry 然后写入文件
-		e := store.NewNoExtraEntry(key, nil, String, StringRem)
-
-		if err := k.store(e); err != nil {
-			return err
-		}
+	k.saveVersion(key)
+	k.removeIndexer(key)
+	// 过期字典处理
+	k.clearExpire(key)
+	// 封装entry 然后写入文件
+	e := store.NewNoExtraEntry(key, nil, String, StringRem)
+
+	if err := k.store(e); err != nil {
+		return false, err
 	}
 
 	// 返回
-	return nil
+	return exist, nil
+}
+
+// Expire 设置以秒为单位的存活时间
+func (k *Kvstore) Expire(key []byte, seconds uint64) error {
+	if seconds > math.MaxUint64/1000 {
+		return ErrInvalidExpireTime
+	}
+	return k.PExpire(key, seconds*1000)
+}
+
+// PExpire 设置以毫秒为单位的存活时间
+func (k *Kvstore) PExpire(key []byte, milliseconds uint64) error {
+	return k.expireAt(key, func(now uint64) (uint64, error) {
+		if milliseconds > math.MaxUint64-now {
+			return 0, ErrInvalidExpireTime
+		}
+		return now + milliseconds, nil
+	})
+}
+
+// ExpireAt 设置以秒为单位的unix时间作为过期时间, 过期时间已经过去时直接删除键
+func (k *Kvstore) ExpireAt(key []byte, timestamp uint64) error {
+	if timestamp > math.MaxUint64/1000 {
+		return ErrInvalidExpireTime
+	}
+	return k.PExpireAt(key, timestamp*1000)
+}
+
+// PExpireAt 设置以毫秒为单位的unix时间作为过期时间, 过期时间已经过去时直接删除键
+func (k *Kvstore) PExpireAt(key []byte, timestamp uint64) error {
+	return k.expireAt(key, func(uint64) (uint64, error) {
+		return timestamp, nil
+	})
 }
 
-// Expire 设置过期时间
-func (k *Kvstore) Expire(key []byte, seconds uint64) (err error) {
+// 设置过期时间, deadline根据当前时间计算以毫秒为单位的过期时间
+func (k *Kvstore) expireAt(key []byte, deadline func(now uint64) (uint64, error)) error {
 	// 检查键值是否合法
-	err = k.checkKeyValue(key, nil)
-	if err != nil {
+	if err := k.checkKeyValue(key, nil); err != nil {
 		return err
 	}
 
 	// 加锁
-	k.strIndex.mu.Lock()
-	defer k.strIndex.mu.Unlock()
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	defer k.flushIndex()
 
 	// 判断索引表是否存在键值对
-	ele := k.strIndex.skl.Find(key)
-	if ele == nil {
+	if k.strIndex.index.Get(key) == nil || k.expired(key) {
 		return ErrKeyNotExist
 	}
 
+	now := k.now()
+	d, err := deadline(now)
+	if err != nil {
+		return err
+	}
+	// 过期时间已经过去, 直接删除
+	if d <= now {
+		return k.removeExpired(key)
+	}
+
+	// 过期时间写入文件
+	if err := k.store(newExpireEntry(key, d)); err != nil {
+		return err
+	}
+
 	// 更新过期时间
-	deadline := uint64(time.Now().Unix()) + seconds
-	k.expires[string(key)] = deadline
-	return
+	k.saveVersion(key)
+	k.setExpire(key, d)
+	return nil
+}
+
+// Persist 删除过期时间, 使键永久有效
+func (k *Kvstore) Persist(key []byte) error {
+	// 检查键值是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+
+	// 加锁
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+
+	// 判断索引表是否存在键值对
+	if k.strIndex.index.Get(key) == nil || k.expired(key) {
+		return ErrKeyNotExist
+	}
+	if _, exist := k.expires[string(key)]; !exist {
+		return ErrKeyIsPermanent
+	}
+
+	// 写入文件
+	if err := k.store(store.NewNoExtraEntry(key, nil, String, StringPersist)); err != nil {
+		return err
+	}
+
+	// 删除过期时间
+	k.saveVersion(key)
+	k.clearExpire(key)
+	return nil
 }
-// TTL 获得存活时间
+
+// TTL 获得以秒为单位的剩余存活时间, 四舍五入
 func (k *Kvstore) TTL(key []byte) (uint64, error) {
+	remain, err := k.PTTL(key)
+	if err != nil {
+		return 0, err
+	}
+	return (remain + 500) / 1000, nil
+}
+
+// PTTL 获得以毫秒为单位的剩余存活时间
+func (k *Kvstore) PTTL(key []byte) (uint64, error) {
 	// 检查键值是否合法
 	err := k.checkKeyValue(key, nil)
 	if err != nil {
@@ -167,8 +420,7 @@ func (k *Kvstore) TTL(key []byte) (uint64, error) {
 	defer k.strIndex.mu.RUnlock()
 
 	// 判断索引表是否存在键值对
-	ele := k.strIndex.skl.Find(key)
-	if ele == nil {
+	if k.strIndex.index.Get(key) == nil {
 		return 0, ErrKeyNotExist
 	}
 
@@ -177,55 +429,154 @@ func (k *Kvstore) TTL(key []byte) (uint64, error) {
 		return 0, ErrKeyIsPermanent
 	}
 
-	now := uint64(time.Now().Unix())
-	remain := deadline - now
-	if remain <= 0 {
+	now := k.now()
+	if deadline <= now {
 		return 0, ErrKeyHasExpired
 	}
-	return remain, nil
+	return deadline - now, nil
 }
 
-// 建立索引信息并且将操作写入文件
-func (k *Kvstore) doSet(key, value []byte) error {
-	// 封装成entry
-	e := store.NewNoExtraEntry(key, value, String, StringSet)
+// 建立索引信息并且将操作写入文件, deadline大于0时同时设置过期时间, 调用方需持有字符串索引表的锁
+func (k *Kvstore) doSet(key, value []byte, deadline uint64) error {
+	// 封装成entry, 重放时设置键会清除过期时间, 因此过期时间写在之后
+	entries := []*store.Entry{store.NewNoExtraEntry(key, value, String, StringSet)}
+	if deadline > 0 {
+		entries = append(entries, newExpireEntry(key, deadline))
+	}
 
-	// 写入文件
-	if err := k.store(e); err != nil {
+	// 写入文件, 部分写入成功时同样更新索引表, 与重放的结果保持一致
+	indexes, err := k.storeBatch(entries...)
+	if len(indexes) == 0 {
 		return err
 	}
 
+	// 更新索引表信息
+	k.setIndexer(indexes[0])
+	k.clearExpire(key)
+	if len(indexes) == len(entries) && deadline > 0 {
+		k.setExpire(key, deadline)
+	}
+
+	// 返回
+	return err
+}
+
+// 将写入位置更新到字符串索引表, 调用方需持有字符串索引表的锁
+func (k *Kvstore) setIndexer(pos *index.Indexer) {
 	// 封装成写入索引表的数据
+	key := pos.Meta.Key
 	idx := &index.Indexer{
 		Meta: &store.Meta{Key: key, KeySize: uint32(len(key))},
-		FileId: k.activeFileId,
-		EntrySize: e.Size(),
-		Offset: k.activeFile.Offset-int64(e.Size()),
+		FileId: pos.FileId,
+		EntrySize: pos.EntrySize,
+		Offset: pos.Offset,
 	}
 
 	// 键值模式
 	if k.config.IdxMode == KeyValueMode {
-		idx.Meta.Value = e.Meta.Value
-		idx.Meta.ValueSize = e.Meta.ValueSize
+		idx.Meta.Value = pos.Meta.Value
+		idx.Meta.ValueSize = pos.Meta.ValueSize
 	}
 
-	// 更新索引表信息
-	k.strIndex.skl.Insert(idx.Meta.Key, idx)
+	// 更新索引表信息, 原来的entry失效
+	if old := k.strIndex.index.Put(idx.Meta.Key, idx); old != nil {
+		k.addGarbage(old)
+	}
+	k.invalidateValue(key)
+	k.trackKey(key, pos.Meta.Value)
+}
 
-	// 返回
-	return nil
+// 从字符串索引表删除键, 原来的entry记为失效, 调用方需持有字符串索引表的锁
+func (k *Kvstore) removeIndexer(key []byte) {
+	if old := k.strIndex.index.Delete(key); old != nil {
+		k.addGarbage(old)
+	}
+	k.invalidateValue(key)
+	k.untrackKey(key)
+}
+
+// 删除已经过期的键, 调用方需持有字符串索引表的锁
+func (k *Kvstore) removeExpired(key []byte) error {
+	if k.strIndex.index.Get(key) == nil {
+		k.clearExpire(key)
+		return nil
+	}
+	k.saveVersion(key)
+	k.clearExpire(key)
+	k.removeIndexer(key)
+	return k.store(store.NewNoExtraEntry(key, nil, String, StringRem))
 }
 
 // 判断是否过期
 func (k *Kvstore) isExpired(key []byte) bool {
 	k.strIndex.mu.RLock()
 	defer k.strIndex.mu.RUnlock()
-	now := time.Now().Unix()
-	if k.expires[string(key)] <= 0 {
+	return k.expired(key)
+}
+
+// 判断是否过期, 调用方需持有字符串索引表的锁
+func (k *Kvstore) expired(key []byte) bool {
+	deadline, exist := k.expires[string(key)]
+	return exist && deadline <= k.now()
+}
+
+// 不持有字符串索引表的锁时判断是否过期, 没有设置了过期时间的键时不需要加锁
+func (k *Kvstore) expiredLockFree(key []byte) bool {
+	if atomic.LoadInt64(&k.volatile) == 0 {
 		return false
 	}
-	return k.expires[string(key)] <= uint64(now)
+	k.expMu.RLock()
+	defer k.expMu.RUnlock()
+	return k.expired(key)
+}
+
+// 设置过期时间, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) setExpire(key []byte, deadline uint64) {
+	k.expMu.Lock()
+	defer k.expMu.Unlock()
+	k.expires[string(key)] = deadline
+	atomic.StoreInt64(&k.volatile, int64(len(k.expires)))
 }
 
+// 删除过期时间, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) clearExpire(key []byte) {
+	if atomic.LoadInt64(&k.volatile) == 0 {
+		return
+	}
+	k.expMu.Lock()
+	defer k.expMu.Unlock()
+	delete(k.expires, string(key))
+	atomic.StoreInt64(&k.volatile, int64(len(k.expires)))
+}
 
+// 封装设置过期时间的entry, 以毫秒为单位的过期时间写入额外信息
+func newExpireEntry(key []byte, deadline uint64) *store.Entry {
+	return store.NewEntry(key, nil, []byte(strconv.FormatUint(deadline, 10)), String, StringPExpire)
+}
 
+// 判断是否为设置过期时间的操作
+func isExpireMark(mark uint16) bool {
+	return mark == StringExpire || mark == StringPExpire
+}
+
+// 解析设置过期时间的entry中的过期时间, 统一转换为毫秒
+func expireDeadline(extra []byte, mark uint16) (uint64, bool) {
+	deadline, err := strconv.ParseUint(string(extra), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if mark == StringExpire {
+		deadline *= 1000
+	}
+	return deadline, true
+}
+
+// 判断设置过期时间的entry是否与键当前的过期时间一致, 调用方需持有字符串索引表的锁
+func (k *Kvstore) validExpire(e *store.Entry) bool {
+	if k.strIndex.index.Get(e.Meta.Key) == nil {
+		return false
+	}
+	deadline, exist := k.expires[string(e.Meta.Key)]
+	d, ok := expireDeadline(e.Meta.Extra, e.Mark)
+	return exist && ok && d == deadline
+}
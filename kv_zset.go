@@ -0,0 +1,179 @@
+package kvstore
+
+import (
+	"kvstore/index"
+	"kvstore/store"
+	"math"
+	"strconv"
+	"sync"
+)
+
+type ZSetIdx struct {
+	indexes *index.SortedSet
+	mu      sync.RWMutex
+}
+
+// NewZSetIdx 建立有序集合索引表
+func NewZSetIdx() *ZSetIdx {
+	return &ZSetIdx{indexes: index.NewSortedSet()}
+}
+
+// ZAdd 向有序集合中添加成员或更新成员的分数, 返回新增成员的数量
+func (k *Kvstore) ZAdd(key []byte, score float64, member []byte) (int, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, member); err != nil {
+		return 0, err
+	}
+	if math.IsNaN(score) {
+		return 0, ErrInvalidScore
+	}
+	// 内存不足时按照淘汰策略淘汰字符串键, 成员同时保存在字典和跳跃表中
+	if err := k.reserveMemory(index.Cost(key, member, member)); err != nil {
+		return 0, err
+	}
+
+	// 加锁
+	k.zsetIndex.mu.Lock()
+	defer k.zsetIndex.mu.Unlock()
+
+	// 分数没有变化则不需要写入文件
+	if old, exist := k.zsetIndex.indexes.ZScore(string(key), member); exist && old == score {
+		return 0, nil
+	}
+
+	if err := k.zadd(key, score, member); err != nil {
+		return 0, err
+	}
+	return k.zsetIndex.indexes.ZAdd(string(key), score, member), nil
+}
+
+// ZScore 返回有序集合中成员的分数
+func (k *Kvstore) ZScore(key, member []byte) (float64, bool) {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return 0, false
+	}
+
+	// 加锁
+	k.zsetIndex.mu.RLock()
+	defer k.zsetIndex.mu.RUnlock()
+
+	return k.zsetIndex.indexes.ZScore(string(key), member)
+}
+
+// ZIncrBy 增加有序集合中成员的分数, 返回新的分数
+func (k *Kvstore) ZIncrBy(key []byte, increment float64, member []byte) (float64, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, member); err != nil {
+		return 0, err
+	}
+	// 内存不足时按照淘汰策略淘汰字符串键, 成员同时保存在字典和跳跃表中
+	if err := k.reserveMemory(index.Cost(key, member, member)); err != nil {
+		return 0, err
+	}
+
+	// 加锁
+	k.zsetIndex.mu.Lock()
+	defer k.zsetIndex.mu.Unlock()
+
+	// 以增加后的分数写入文件, 保证重放结果一致
+	score, _ := k.zsetIndex.indexes.ZScore(string(key), member)
+	score += increment
+	if math.IsNaN(score) {
+		return 0, ErrInvalidScore
+	}
+	if err := k.zadd(key, score, member); err != nil {
+		return 0, err
+	}
+	k.zsetIndex.indexes.ZAdd(string(key), score, member)
+	return score, nil
+}
+
+// ZRem 删除有序集合中的成员, 返回被删除成员的数量
+func (k *Kvstore) ZRem(key []byte, members ...[]byte) (res int, err error) {
+	// 检查数据是否合法
+	if err = k.checkKeyValue(key, members...); err != nil {
+		return
+	}
+
+	// 加锁
+	k.zsetIndex.mu.Lock()
+	defer k.zsetIndex.mu.Unlock()
+
+	for _, m := range members {
+		// 成员不存在则跳过
+		if _, exist := k.zsetIndex.indexes.ZScore(string(key), m); !exist {
+			continue
+		}
+
+		// 封装entry, 然后写入文件
+		e := store.NewNoExtraEntry(key, m, ZSet, ZSetZRem)
+		if err = k.store(e); err != nil {
+			return
+		}
+
+		// 更新索引表
+		res += k.zsetIndex.indexes.ZRem(string(key), m)
+	}
+	return
+}
+
+// ZCard 返回有序集合中成员的数量
+func (k *Kvstore) ZCard(key []byte) int {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return 0
+	}
+
+	// 加锁
+	k.zsetIndex.mu.RLock()
+	defer k.zsetIndex.mu.RUnlock()
+
+	return k.zsetIndex.indexes.ZCard(string(key))
+}
+
+// ZRank 返回成员按分数从小到大的排名
+func (k *Kvstore) ZRank(key, member []byte) (int, bool) {
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return 0, false
+	}
+
+	// 加锁
+	k.zsetIndex.mu.RLock()
+	defer k.zsetIndex.mu.RUnlock()
+
+	return k.zsetIndex.indexes.ZRank(string(key), member)
+}
+
+// ZRange 返回排名在[start, stop]之间的成员
+func (k *Kvstore) ZRange(key []byte, start, stop int) ([][]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.zsetIndex.mu.RLock()
+	defer k.zsetIndex.mu.RUnlock()
+
+	return k.zsetIndex.indexes.ZRange(string(key), start, stop), nil
+}
+
+// ZRangeByScore 返回分数在[min, max]之间的成员
+func (k *Kvstore) ZRangeByScore(key []byte, min, max float64) ([][]byte, error) {
+	// 检查数据是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁
+	k.zsetIndex.mu.RLock()
+	defer k.zsetIndex.mu.RUnlock()
+
+	return k.zsetIndex.indexes.ZRangeByScore(string(key), min, max), nil
+}
+
+// 将成员及分数写入文件, 分数保存在额外信息中
+func (k *Kvstore) zadd(key []byte, score float64, member []byte) error {
+	extra := []byte(strconv.FormatFloat(score, 'g', -1, 64))
+	e := store.NewEntry(key, member, extra, ZSet, ZSetZAdd)
+	return k.store(e)
+}
@@ -1,13 +1,18 @@
 package kvstore
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"kvstore/cache"
 	"kvstore/index"
 	"kvstore/store"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -38,35 +43,82 @@ var (
 	// ErrKeyHasExpired 该键已经过期
 	ErrKeyHasExpired = errors.New("the key has expired")
 
+	// ErrInvalidExpireTime 过期时间超出范围
+	ErrInvalidExpireTime = errors.New("kvstore: invalid expire time")
+
+	// ErrInvalidSetOptions 设置字符串的可选参数冲突
+	ErrInvalidSetOptions = errors.New("kvstore: conflicting set options")
+
+	// ErrIndexOutOfRange 下标越界
+	ErrIndexOutOfRange = errors.New("kvstore: index is out of range")
+
+	// ErrInvalidScore 分数不合法
+	ErrInvalidScore = errors.New("kvstore: score is not a valid float")
+
+	// ErrCorruptedFile 数据文件损坏
+	ErrCorruptedFile = errors.New("kvstore: data file is corrupted")
+
+	// ErrKeySizeExceedsDiskIndex 键的最大长度超出磁盘索引表的限制
+	ErrKeySizeExceedsDiskIndex = errors.New("kvstore: max key size exceeds the limit of disk index")
+
 )
 
 const (
 	// 重写数据文件临时目录
 	rewritePath = "/tmp/kvStore/Rewrite"
-
-	// 过期字典目录
-	expiresPath = "/tmp/kvStore/expires.data"
 )
 
 type Kvstore struct {
+	// 过期字典中键的数量, 64位原子操作的字段放在开头保证对齐
+	volatile int64
 	// 当前活跃文件
 	activeFile *store.KvFile
 	// 当前活跃文件id
 	activeFileId uint32
+	// 当前活跃文件的索引记录, 归档时写入索引文件
+	activeHints []*store.Hint
 	// 归档文件
 	archFiles map[uint32]*store.KvFile
 	// 字符串索引表
 	strIndex *StrIdx
+	// 哈希索引表
+	hashIndex *HashIdx
+	// 列表索引表
+	listIndex *ListIdx
+	// 集合索引表
+	setIndex *SetIdx
+	// 有序集合索引表
+	zsetIndex *ZSetIdx
 	// 数据库配置信息
 	config *Config
 	// 读写锁
 	mu sync.RWMutex
-	// 过期字典
+	// 过期字典, 过期时间以entry写入文件, 启动时重放得到, 由字符串索引表的锁保护
+	// 修改时同时持有expMu, 不持有字符串索引表的锁的读操作通过expMu读取
 	expires store.Expires
+	expMu sync.RWMutex
+	// 被监视的键, 由mu保护
+	watchers map[string]map[*Watcher]struct{}
+	// 后台合并
+	merger *merger
+	// 各数据文件的垃圾数据统计
+	stats *garbageStats
+	// 后台主动过期
+	expirer *expirer
+	// 判断键是否过期使用的时钟, 保存clockValue, 不持有锁的读操作也会读取
+	clock atomic.Value
+	// 从文件读取的字符串值的缓存, 值保存在索引表中时为空
+	values *cache.Cache
+	// 字符串键值的内存上限和淘汰, 没有设置内存上限时为空
+	evictor *evictor
 }
 
 // Open 初始化数据库
 func Open(config *Config) (*Kvstore, error) {
+	// 检查淘汰策略, 避免打开数据文件之后才发现配置错误
+	if err := checkEvictionPolicy(config.EvictionPolicy); err != nil {
+		return nil, err
+	}
 	if _, err := os.Stat(config.DirPath); os.IsNotExist(err) {
 		err = os.MkdirAll(config.DirPath, os.ModePerm)
 		if err != nil {
@@ -83,11 +135,6 @@ func Open(config *Config) (*Kvstore, error) {
 	if err != nil {
 		return nil, err
 	}
-	// 加载过期字典
-	expires, err := store.LoadExpires(expiresPath)
-	if err != nil {
-		return nil, err
-	}
 	// 加载额外信息
 
 	// 初始化数据库
@@ -95,15 +142,54 @@ func Open(config *Config) (*Kvstore, error) {
 		activeFile: file,
 		activeFileId: activeFileId,
 		archFiles: archFiles,
-		strIndex: NewStrIdx(),
+		strIndex: NewStrIdx(config.IndexType),
+		hashIndex: NewHashIdx(),
+		listIndex: NewListIdx(),
+		setIndex: NewSetIdx(),
+		zsetIndex: NewZSetIdx(),
 		config: config,
-		expires: expires,
+		expires: make(store.Expires),
+		watchers: make(map[string]map[*Watcher]struct{}),
+		merger: newMerger(),
+		stats: newGarbageStats(),
+		expirer: newExpirer(),
+		values: newValueCache(config),
+		evictor: newEvictor(config),
+	}
+	kv.clock.Store(clockValue{systemClock{}})
+
+	// 字符串的键保存在磁盘索引表中
+	if config.IdxMode == DiskIndexMode {
+		if err := kv.openDiskIndex(); err != nil {
+			return nil, err
+		}
 	}
 
 	//启动数据库时， 加载数据库文件
 	if err := kv.loadIdxFromFiles(); err != nil {
 		return nil, err
 	}
+	// 重放完成后提交磁盘索引表
+	if err := kv.checkpointIndex(); err != nil {
+		return nil, err
+	}
+	// 加载垃圾数据统计
+	if err := kv.loadStats(); err != nil {
+		return nil, err
+	}
+	// 迁移旧版本的过期字典
+	if err := kv.migrateExpires(); err != nil {
+		return nil, err
+	}
+
+	// 根据配置定时合并归档文件
+	if config.MergeInterval > 0 {
+		go kv.runMerger(config.MergeInterval)
+	}
+	// 根据配置定时清理过期键
+	if config.ExpireInterval > 0 {
+		go kv.runExpirer(config.ExpireInterval)
+	}
 
 	// 返回
 	return kv, nil
@@ -111,6 +197,15 @@ func Open(config *Config) (*Kvstore, error) {
 
 // Close 关闭数据库
 func (k *Kvstore) Close() error {
+	// 停止后台合并和过期清理
+	k.stopMerger()
+	k.stopExpirer()
+
+	// 提交并关闭磁盘索引表
+	if err := k.closeIndex(); err != nil {
+		return err
+	}
+
 	// 加锁
 	k.mu.Lock()
 	defer k.mu.Unlock()
@@ -119,14 +214,20 @@ func (k *Kvstore) Close() error {
 
 	// 保存额外信息
 
-	// 保存过期字典
-	if err := k.expires.SaveExpires(expiresPath); err != nil {
+	// 保存垃圾数据统计
+	if err := k.saveStats(); err != nil {
 		return err
 	}
 	// 关闭当前活跃文件
 	if err := k.activeFile.Close(true);  err != nil {
 		return err
 	}
+	// 关闭归档文件
+	for _, f := range k.archFiles {
+		if err := f.Close(false); err != nil {
+			return err
+		}
+	}
 	// 返回
 	return nil
 }
@@ -171,51 +272,106 @@ func (k *Kvstore) buildIndex(e *store.Entry, idx *index.Indexer) {
 	if k.config.IdxMode == KeyValueMode {
 		idx.Meta.Value = e.Meta.Value
 		idx.Meta.ValueSize = uint32(len(idx.Meta.Value))
+	} else if e.Type == String {
+		// 只有键的模式下字符串索引表不保存值
+		idx.Meta = &store.Meta{Key: e.Meta.Key, KeySize: e.Meta.KeySize, Extra: e.Meta.Extra, ExtraSize: e.Meta.ExtraSize}
 	}
 
 	switch e.Type {
 	case String:
 		// 针对字符串的写入操作
 		k.buildStringIndex(idx, e.Mark)
+	case Hash:
+		// 针对哈希表的写入操作
+		k.buildHashIndex(idx, e.Mark)
+	case List:
+		// 针对列表的写入操作
+		k.buildListIndex(idx, e.Mark)
+	case Set:
+		// 针对集合的写入操作
+		k.buildSetIndex(idx, e.Mark)
+	case ZSet:
+		// 针对有序集合的写入操作
+		k.buildZSetIndex(idx, e.Mark)
 	}
 }
 
 // 将命令和数据写入磁盘
 func(k *Kvstore) store(e *store.Entry) error {
+	_, err := k.storeBatch(e)
+	return err
+}
+
+// 在同一把锁下依次写入多条数据, 数据之间不会插入其他写入, 返回每条数据写入的位置
+func (k *Kvstore) storeBatch(entries ...*store.Entry) ([]*index.Indexer, error) {
+	// 加锁, 不同类型的索引表可能同时写入活跃文件
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	indexes, err := k.appendEntries(entries...)
+
+	// 标记监视写入成功的键的监视器
+	for _, idx := range indexes {
+		k.touch(idx.Meta.Key)
+	}
+	return indexes, err
+}
+
+// 将数据条依次追加到活跃文件, 返回写入成功的数据条的位置, 调用方需持有k.mu
+func (k *Kvstore) appendEntries(entries ...*store.Entry) ([]*index.Indexer, error) {
 	//配置信息
 	config := k.config
-	// 判断当前活跃文件剩余的大小是否满足写入新的数据条
-	if k.activeFile.Offset+int64(e.Size()) > config.BlockSize {
-		//将当前文件同步到外存， 关闭当前文件
-		if err := k.activeFile.Close(true); err != nil {
-			return err
-		}
-		// 归档
-		k.archFiles[k.activeFileId] = k.activeFile
+	indexes := make([]*index.Indexer, 0, len(entries))
+	for _, e := range entries {
+		// 判断当前活跃文件剩余的大小是否满足写入新的数据条
+		if k.activeFile.Offset+int64(e.Size()) > config.BlockSize {
+			//将当前文件同步到外存, 归档后仍然需要读取, 因此不关闭
+			if err := k.activeFile.Sync(); err != nil {
+				return indexes, err
+			}
+			// 归档, 并写入索引文件
+			k.archFiles[k.activeFileId] = k.activeFile
+			if err := store.SaveHints(config.DirPath, k.activeFileId, k.activeHints); err != nil {
+				return indexes, err
+			}
+			k.activeHints = nil
 
-		// 打开新的文件
-		file, err := store.NewKvFile(config.DirPath, k.activeFileId+1, config.Method, config.BlockSize)
-		if err != nil {
-			return err
+			// 打开新的文件
+			file, err := store.NewKvFile(config.DirPath, k.activeFileId+1, config.Method, config.BlockSize)
+			if err != nil {
+				return indexes, err
+			}
+
+			// 更新数据库
+			k.activeFile = file
+			k.activeFileId++
+		}
+		// 将数据条写入当前活跃文件
+		if err := k.activeFile.Write(e); err != nil {
+			return indexes, err
 		}
 
-		// 更新数据库
-		k.activeFile = file
-		k.activeFileId++
-	}
-	// 将数据条写入当前活跃文件
-	if err := k.activeFile.Write(e); err != nil {
-		return err
+		// 记录写入位置
+		offset := k.activeFile.Offset-int64(e.Size())
+		idx := &index.Indexer{
+			Meta: e.Meta,
+			FileId: k.activeFileId,
+			EntrySize: e.Size(),
+			Offset: offset,
+		}
+		indexes = append(indexes, idx)
+		k.countEntry(idx, e)
+		k.activeHints = append(k.activeHints, store.NewHint(e, k.activeFileId, offset))
 	}
 
 	// 根据配置是否立即同步外存
 	if config.Sync {
 		if err := k.activeFile.Sync(); err != nil {
-			return err
+			return indexes, err
 		}
 	}
 	// 返回
-	return nil
+	return indexes, nil
 }
 
 // Rewrite 重写归档数据库文件， 删除冗余数据
@@ -224,6 +380,10 @@ func (k *Kvstore) Rewrite() error {
 	if len(k.archFiles) < k.config.ReWriteThreshold {
 		return ErrLessThanReWriteThreshold
 	}
+	// 重写期间不能合并
+	k.merger.run.Lock()
+	defer k.merger.run.Unlock()
+
 	// 新建重写目录
 	rewrites := k.config.DirPath + rewritePath
 	err := os.MkdirAll(rewrites, os.ModePerm)
@@ -232,31 +392,120 @@ func (k *Kvstore) Rewrite() error {
 	}
 	defer os.RemoveAll(rewrites)
 
-	// 加锁
+	// 加锁, 先锁住各类型索引表, 再锁住数据库文件
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+	k.hashIndex.mu.Lock()
+	defer k.hashIndex.mu.Unlock()
+	k.listIndex.mu.Lock()
+	defer k.listIndex.mu.Unlock()
+	k.setIndex.mu.Lock()
+	defer k.setIndex.mu.Unlock()
+	k.zsetIndex.mu.Lock()
+	defer k.zsetIndex.mu.Unlock()
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
+	// 重写会重新编号数据文件, 磁盘索引表的检查点先失效, 重写完成后重新提交
+	tree, disk := k.diskIndex()
+	if disk {
+		if err := tree.Invalidate(); err != nil {
+			return err
+		}
+	}
+
 	var (
 		newArchFiles = make(map[uint32]*store.KvFile)
 		activeFileId uint32 = 0
 		df *store.KvFile
+		// 新文件的索引记录
+		newHints = make(map[uint32][]*store.Hint)
+		// 新文件的垃圾数据统计
+		newStats = make(store.FileStats)
+		// 被快照引用的历史版本
+		history = k.historyPositions()
 	)
 
-	k.archFiles[k.activeFileId] = k.activeFile
-	// 整理归档文件中的数据条entry
-	for _, f := range k.archFiles {
-		var newEntries []*store.Entry
-		var offset int64 = 0
-		kf, err := os.Open(f.File.Name())
-		if err != nil {
+	// 将entry写入重写目录的新文件中, pos为entry原来的位置
+	rewriteEntry := func(e *store.Entry, pos *entryPos) error {
+		// 找出引用该entry的当前版本和历史版本
+		var current *index.Indexer
+		var versions []*index.Indexer
+		if e.Type == String && pos != nil {
+			if idx := k.strIndex.index.Get(e.Meta.Key); idx != nil {
+				if idx.FileId == pos.fid && idx.Offset == pos.offset {
+					current = idx
+				}
+			}
+			// 只被快照引用的历史版本以快照标记写入, 重放时忽略
+			versions = history[*pos]
+			if current == nil && len(versions) > 0 {
+				e = store.NewNoExtraEntry(e.Meta.Key, e.Meta.Value, String, StringSnapshot)
+			}
+		}
+
+		// 判断当前文件是否为空， 或者剩余位置是否满足写入
+		if df == nil || (df.Offset + int64(e.Size())) > k.config.BlockSize {
+			df, err = store.NewKvFile(rewrites, activeFileId, k.config.Method, k.config.BlockSize)
+			if err != nil {
+				return err
+			}
+			// 归档
+			newArchFiles[activeFileId] = df
+			activeFileId++
+		}
+		// 将entry写入新文件中
+		if err := df.Write(e); err != nil {
 			return err
 		}
-		f.File = kf
+
+		//更新索引表信息
+		offset := df.Offset - int64(e.Size())
+		newHints[df.Id] = append(newHints[df.Id], store.NewHint(e, df.Id, offset))
+		st := newStats[df.Id]
+		if st == nil {
+			st = &store.FileStat{}
+			newStats[df.Id] = st
+		}
+		countStat(st, e, int64(e.Size()))
+		if current != nil {
+			current.Offset = offset
+			current.FileId = df.Id
+			// 磁盘索引表返回的是副本, 需要重新写入位置
+			k.strIndex.index.Put(current.Meta.Key, current)
+			// 修改过的页较多时提交, 重写完成之前检查点保持失效
+			if disk && tree.NeedCommit() {
+				if err := tree.Invalidate(); err != nil {
+					return err
+				}
+			}
+		}
+		for _, v := range versions {
+			v.Offset = offset
+			v.FileId = df.Id
+		}
+		return nil
+	}
+
+	k.archFiles[k.activeFileId] = k.activeFile
+	// 按照文件顺序整理归档文件中的数据条entry
+	fileIds := make([]int, 0, len(k.archFiles))
+	for fid := range k.archFiles {
+		fileIds = append(fileIds, int(fid))
+	}
+	sort.Ints(fileIds)
+	for _, fid := range fileIds {
+		f := k.archFiles[uint32(fid)]
+		var newEntries []*store.Entry
+		var positions []entryPos
+		var offset int64 = store.FileHeaderSize
 		for offset <= k.config.BlockSize {
 			if e, err := f.Read(offset); err == nil {
-				// 判断数据条是否满足重写条件
-				if k.validEntry(e) {
+				// 判断数据条是否满足重写条件, 被快照引用的数据条也需要保留
+				pos := entryPos{fid: f.Id, offset: offset}
+				if k.validEntry(e, f.Id, offset) || (e.Type == String && len(history[pos]) > 0) {
 					newEntries = append(newEntries, e)
+					positions = append(positions, pos)
 				}
 				offset += int64(e.Size())
 			} else {
@@ -267,39 +516,30 @@ func (k *Kvstore) Rewrite() error {
 			}
 		}
 
-		if len(newEntries) > 0 {
-			for _, e := range newEntries {
-				// 判断当前文件是否为空， 或者剩余位置是否满足写入
-				if df == nil || (df.Offset + int64(e.Size())) > k.config.BlockSize {
-					df, err = store.NewKvFile(rewrites, activeFileId, k.config.Method, k.config.BlockSize)
-					if err != nil {
-						return err
-					}
-					// 归档
-					newArchFiles[activeFileId] = df
-					activeFileId++
-				}
-				// 将entry写入新文件中
-				if err := df.Write(e); err != nil {
-					return err
-				}
-
-				//更新索引表信息
-				if e.Type == String {
-					node := k.strIndex.skl.Find(e.Meta.Key)
-					v := node.Value().(*index.Indexer)
-					v.Offset = df.Offset - int64(e.Size())
-					v.FileId = df.Id
-					k.strIndex.skl.Insert(e.Meta.Key, v)
-				}
-
+		for i, e := range newEntries {
+			if err := rewriteEntry(e, &positions[i]); err != nil {
+				return err
 			}
 		}
 	}
 
-	// 删除旧文件
+	// 列表的操作依赖顺序, 无法逐条筛选, 直接写入列表当前的内容
+	for _, e := range k.listEntries() {
+		if err := rewriteEntry(e, nil); err != nil {
+			return err
+		}
+	}
+
+	// 关闭并删除旧文件及其索引文件
 	for _, v := range k.archFiles {
-		if err := os.Remove(v.File.Name()); err != nil {
+		path := v.File.Name()
+		if err := v.Close(false); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if err := store.RemoveHints(k.config.DirPath, v.Id); err != nil {
 			return err
 		}
 	}
@@ -322,19 +562,42 @@ func (k *Kvstore) Rewrite() error {
 		df = newArchFiles[activeFileId]
 		delete(newArchFiles, activeFileId)
 	}
+	// 为新的归档文件写入索引文件
+	for fid := range newArchFiles {
+		if err := store.SaveHints(k.config.DirPath, fid, newHints[fid]); err != nil {
+			return err
+		}
+	}
 	// 修改归档文件指向
 	k.archFiles = newArchFiles
+	k.activeHints = newHints[activeFileId]
+	k.stats.mu.Lock()
+	k.stats.files = newStats
+	k.stats.mu.Unlock()
 
 	// 更新当前活跃文件
 	k.activeFile = df
 	k.activeFileId = activeFileId
+	k.purgeValues()
+
+	// 新的数据文件同步到磁盘之后再提交磁盘索引表
+	if disk {
+		for _, f := range k.archFiles {
+			if err := f.Sync(); err != nil {
+				return err
+			}
+		}
+		if err := k.commitIndex(tree); err != nil {
+			return err
+		}
+	}
 
 	// 返回
 	return nil
 }
 
-// 用来整理归档数据库文件， 删除冗余数据
-func (k *Kvstore) validEntry(e *store.Entry) bool {
+// 用来整理归档数据库文件， 删除冗余数据, 调用方需持有各索引表的锁
+func (k *Kvstore) validEntry(e *store.Entry, fid uint32, offset int64) bool {
 	if e == nil {
 		return false
 	}
@@ -342,13 +605,38 @@ func (k *Kvstore) validEntry(e *store.Entry) bool {
 	switch e.Type {
 	case String:
 		if e.Mark == StringSet {
-			// 过期字典相关处理
-
-			// 对比值是否一致
-			if v, err := k.Get(e.Meta.Key); err == nil && string(e.Meta.Value) == string(v) {
+			// 对比索引表中记录的位置是否一致
+			if idx := k.strIndex.index.Get(e.Meta.Key); idx != nil {
+				return idx.FileId == fid && idx.Offset == offset
+			}
+		}
+		if isExpireMark(e.Mark) {
+			// 对比当前的过期时间是否一致
+			return k.validExpire(e)
+		}
+	case Hash:
+		if e.Mark == HashHSet {
+			// 对比字段的值是否一致, 重放得到的空值为nil, 需要单独判断字段是否存在
+			key, field := string(e.Meta.Key), string(e.Meta.Extra)
+			if k.hashIndex.indexes.HExists(key, field) && bytes.Equal(k.hashIndex.indexes.HGet(key, field), e.Meta.Value) {
 				return true
 			}
 		}
+	case Set:
+		if e.Mark == SetSAdd {
+			// 判断成员是否仍然存在
+			return k.setIndex.indexes.SIsMember(string(e.Meta.Key), e.Meta.Value)
+		}
+	case ZSet:
+		if e.Mark == ZSetZAdd {
+			// 对比成员的分数是否一致
+			score, err := strconv.ParseFloat(string(e.Meta.Extra), 64)
+			if err != nil {
+				return false
+			}
+			v, exist := k.zsetIndex.indexes.ZScore(string(e.Meta.Key), e.Meta.Value)
+			return exist && v == score
+		}
 	}
 	// 返回
 	return false
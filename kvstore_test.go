@@ -0,0 +1,51 @@
+package kvstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// 数据文件较小, 少量写入就会产生归档文件, 便于测试重写和合并
+func testConfig(t *testing.T) *Config {
+	dir, err := ioutil.TempDir("", "kvstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 1024
+	config.ReWriteThreshold = 1
+	return config
+}
+
+func openTestKv(t *testing.T, config *Config) *Kvstore {
+	t.Helper()
+	kv, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv
+}
+
+// 关闭后重新打开, 索引从数据文件中重放得到
+func reopenTestKv(t *testing.T, kv *Kvstore, config *Config) *Kvstore {
+	t.Helper()
+	if err := kv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return openTestKv(t, config)
+}
+
+// 写入无关的字符串键, 使之前的数据落在归档文件中
+func fillArchFiles(t *testing.T, kv *Kvstore, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := kv.Set([]byte(fmt.Sprintf("filler-%04d", i)), make([]byte, 64)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"kvstore/index"
+	"kvstore/store"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrMergeInProgress 已经有合并任务在执行
+var ErrMergeInProgress = errors.New("kvstore: merge is in progress")
+
+// 合并时每次加锁处理的entry数量
+const mergeBatchSize = 128
+
+// MergeProgress 合并进度
+type MergeProgress struct {
+	// Running 是否正在合并
+	Running bool
+	// Files 本次合并选中的文件数量
+	Files int
+	// Merged 已经合并完成的文件数量
+	Merged int
+	// Current 正在合并的文件
+	Current uint32
+	// Reclaimed 已经回收的空间大小
+	Reclaimed int64
+	// StartTime 合并开始时间
+	StartTime time.Time
+	// EndTime 合并结束时间
+	EndTime time.Time
+	// Err 合并发生的错误
+	Err error
+}
+
+// 后台合并的状态
+type merger struct {
+	// 保证同一时间只有一个合并或重写任务
+	run sync.Mutex
+	// 保护合并进度
+	mu       sync.Mutex
+	progress MergeProgress
+	// 关闭数据库时通知后台合并协程退出
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newMerger() *merger {
+	return &merger{stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Merge 合并垃圾数据比例较高的归档文件
+// 文件中仍然有效的entry会被追加到活跃文件, 每处理一批entry只短暂加锁, 不会长时间阻塞写入
+func (k *Kvstore) Merge() error {
+	m := k.merger
+	m.mu.Lock()
+	if m.progress.Running {
+		m.mu.Unlock()
+		return ErrMergeInProgress
+	}
+	m.progress = MergeProgress{Running: true, StartTime: time.Now()}
+	m.mu.Unlock()
+
+	m.run.Lock()
+	err := k.merge()
+	m.run.Unlock()
+
+	m.mu.Lock()
+	m.progress.Running = false
+	m.progress.EndTime = time.Now()
+	m.progress.Err = err
+	m.mu.Unlock()
+	return err
+}
+
+// MergeProgress 返回当前或上一次合并的进度
+func (k *Kvstore) MergeProgress() MergeProgress {
+	k.merger.mu.Lock()
+	defer k.merger.mu.Unlock()
+	return k.merger.progress
+}
+
+// 定时执行合并, 直到数据库关闭
+func (k *Kvstore) runMerger(interval time.Duration) {
+	defer close(k.merger.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.merger.stop:
+			return
+		case <-ticker.C:
+			if err := k.Merge(); err != nil && err != ErrMergeInProgress {
+				log.Printf("merge failed : %s\n", err.Error())
+			}
+		}
+	}
+}
+
+// 通知后台合并退出, 并等待正在执行的合并结束
+func (k *Kvstore) stopMerger() {
+	m := k.merger
+	if k.mergeStopped() {
+		return
+	}
+	close(m.stop)
+	if k.config.MergeInterval > 0 {
+		<-m.done
+	}
+	m.run.Lock()
+	m.run.Unlock()
+}
+
+func (k *Kvstore) merge() error {
+	// 数据库已经关闭
+	if k.mergeStopped() {
+		return nil
+	}
+	files, err := k.mergeCandidates()
+	if err != nil {
+		return err
+	}
+	k.updateProgress(func(p *MergeProgress) {
+		p.Files = len(files)
+	})
+
+	for _, f := range files {
+		// 数据库关闭时停止合并
+		if k.mergeStopped() {
+			return nil
+		}
+
+		k.updateProgress(func(p *MergeProgress) {
+			p.Current = f.Id
+		})
+		reclaimed, err := k.mergeFile(f)
+		if err != nil {
+			return err
+		}
+		k.updateProgress(func(p *MergeProgress) {
+			p.Merged++
+			p.Reclaimed += reclaimed
+		})
+	}
+	return nil
+}
+
+func (k *Kvstore) mergeStopped() bool {
+	select {
+	case <-k.merger.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (k *Kvstore) updateProgress(fn func(p *MergeProgress)) {
+	k.merger.mu.Lock()
+	defer k.merger.mu.Unlock()
+	fn(&k.merger.progress)
+}
+
+// 按文件顺序选出垃圾数据比例达到阈值的归档文件
+// 统计的比例未达到阈值, 但文件中无法跟踪的数据可能使比例达到阈值时, 读取文件计算实际的比例
+func (k *Kvstore) mergeCandidates() ([]*store.KvFile, error) {
+	k.mu.RLock()
+	var files, uncertain []*store.KvFile
+	k.stats.mu.Lock()
+	for fid, f := range k.archFiles {
+		if k.stats.ratio(fid) >= k.config.GarbageRatio {
+			files = append(files, f)
+		} else if k.stats.maxRatio(fid) >= k.config.GarbageRatio {
+			uncertain = append(uncertain, f)
+		}
+	}
+	k.stats.mu.Unlock()
+	k.mu.RUnlock()
+
+	for _, f := range uncertain {
+		ratio, err := k.garbageRatio(f)
+		if err != nil {
+			return nil, err
+		}
+		if ratio >= k.config.GarbageRatio {
+			files = append(files, f)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Id < files[j].Id
+	})
+	return files, nil
+}
+
+// 读取归档文件, 统计其中失效数据所占的比例
+func (k *Kvstore) garbageRatio(f *store.KvFile) (float64, error) {
+	entries, positions, err := k.readMergeFile(f)
+	if err != nil || entries == nil {
+		return 0, err
+	}
+
+	k.rLockIndexes()
+	defer k.rUnlockIndexes()
+
+	history := k.historyPositions()
+	older := k.hasOlderFile(f.Id)
+	var total, live int64
+	for i, e := range entries {
+		total += int64(e.Size())
+		if e.Type == List {
+			live += int64(e.Size())
+		} else if ne, _ := k.mergeEntry(e, positions[i], history, older); ne != nil {
+			live += int64(e.Size())
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(total-live) / float64(total), nil
+}
+
+// 合并一个归档文件, 返回回收的空间大小
+func (k *Kvstore) mergeFile(f *store.KvFile) (int64, error) {
+	entries, positions, err := k.readMergeFile(f)
+	if err != nil || entries == nil {
+		return 0, err
+	}
+
+	var total, written int64
+	lists := make(map[string]struct{})
+	for i := 0; i < len(entries); i += mergeBatchSize {
+		end := i + mergeBatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		n, err := k.mergeEntries(entries[i:end], positions[i:end], lists)
+		if err != nil {
+			return 0, err
+		}
+		written += n
+	}
+	for _, e := range entries {
+		total += int64(e.Size())
+	}
+
+	// 加锁, 写入列表的当前内容, 然后删除旧文件
+	k.lockIndexes()
+	defer k.unlockIndexes()
+
+	n, err := k.mergeLists(lists)
+	if err != nil {
+		return 0, err
+	}
+	written += n
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.archFiles, f.Id)
+	k.stats.mu.Lock()
+	delete(k.stats.files, f.Id)
+	k.stats.mu.Unlock()
+	path := f.File.Name()
+	if err := f.Close(false); err != nil {
+		return 0, err
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, err
+	}
+	if err := store.RemoveHints(k.config.DirPath, f.Id); err != nil {
+		return 0, err
+	}
+
+	// 返回
+	return total - written, nil
+}
+
+// 读取归档文件中所有的entry, 文件中存在跨越其他文件的批量写入时无法单独合并, 返回空
+func (k *Kvstore) readMergeFile(f *store.KvFile) ([]*store.Entry, []entryPos, error) {
+	var entries []*store.Entry
+	var positions []entryPos
+	var offset int64 = store.FileHeaderSize
+	pending := false
+	for offset <= k.config.BlockSize {
+		e, err := f.Read(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, err
+		}
+
+		// 检查批量写入的开始和结束标记是否都在该文件中
+		if e.Type == Batch {
+			if (e.Mark == BatchBegin) == pending {
+				return nil, nil, nil
+			}
+			pending = e.Mark == BatchBegin
+		}
+
+		entries = append(entries, e)
+		positions = append(positions, entryPos{fid: f.Id, offset: offset})
+		offset += int64(e.Size())
+	}
+	if pending {
+		return nil, nil, nil
+	}
+	return entries, positions, nil
+}
+
+// 将一批仍然有效的entry追加到活跃文件, 并更新索引表中记录的位置, 返回写入的大小
+func (k *Kvstore) mergeEntries(entries []*store.Entry, positions []entryPos, lists map[string]struct{}) (int64, error) {
+	// 加锁, 先锁住各类型索引表, 再锁住数据库文件
+	k.lockIndexes()
+	defer k.unlockIndexes()
+
+	history := k.historyPositions()
+	older := k.hasOlderFile(positions[0].fid)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var newEntries []*store.Entry
+	var relocated [][]*index.Indexer
+	for i, e := range entries {
+		// 列表的操作依赖顺序, 合并完成时直接写入列表当前的内容
+		if e.Type == List {
+			lists[string(e.Meta.Key)] = struct{}{}
+			continue
+		}
+		if ne, idxes := k.mergeEntry(e, positions[i], history, older); ne != nil {
+			newEntries = append(newEntries, ne)
+			relocated = append(relocated, idxes)
+
+			// 重放时设置键会清除过期时间, 因此移动之后需要重新写入过期时间
+			if deadline, exist := k.expires[string(e.Meta.Key)]; exist && ne.Type == String && ne.Mark == StringSet {
+				newEntries = append(newEntries, newExpireEntry(e.Meta.Key, deadline))
+				relocated = append(relocated, nil)
+			}
+		}
+	}
+
+	indexes, err := k.appendEntries(newEntries...)
+	var written int64
+	for i, pos := range indexes {
+		written += int64(pos.EntrySize)
+		for _, idx := range relocated[i] {
+			idx.FileId = pos.FileId
+			idx.Offset = pos.Offset
+		}
+		// 当前版本排在最前, 磁盘索引表返回的是副本, 需要重新写入位置
+		if e := newEntries[i]; e.Type == String && e.Mark == StringSet && len(relocated[i]) > 0 {
+			k.strIndex.index.Put(e.Meta.Key, relocated[i][0])
+			k.invalidateValue(e.Meta.Key)
+		}
+	}
+	return written, err
+}
+
+// 写入列表当前的内容, 先清空列表再依次写入元素, 使之前的列表操作全部失效, 调用方需持有各索引表的锁
+func (k *Kvstore) mergeLists(lists map[string]struct{}) (int64, error) {
+	var entries []*store.Entry
+	for key := range lists {
+		clear := []byte("1" + ExtraSeparator + "0")
+		entries = append(entries, store.NewEntry([]byte(key), nil, clear, List, ListLTrim))
+		for _, v := range k.listIndex.indexes.LRange(key, 0, -1) {
+			entries = append(entries, store.NewNoExtraEntry([]byte(key), v, List, ListRPush))
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	indexes, err := k.appendEntries(entries...)
+	var written int64
+	for _, pos := range indexes {
+		written += int64(pos.EntrySize)
+	}
+	return written, err
+}
+
+// 判断合并时是否需要保留entry, 返回需要重新写入的entry以及需要更新位置的索引信息, 返回空表示entry已经失效
+// older表示存在更早的归档文件, 此时删除标记需要保留, 否则更早的文件中被删除的数据会在重放时恢复
+// 调用方需持有各索引表的锁
+func (k *Kvstore) mergeEntry(e *store.Entry, pos entryPos, history map[entryPos][]*index.Indexer, older bool) (*store.Entry, []*index.Indexer) {
+	if len(e.Meta.Key) == 0 {
+		return nil, nil
+	}
+	key := string(e.Meta.Key)
+
+	switch e.Type {
+	case String:
+		if isExpireMark(e.Mark) {
+			if k.validExpire(e) {
+				return e, nil
+			}
+			return nil, nil
+		}
+		// 删除过期时间的标记与删除标记一样, 存在更早的归档文件时需要保留
+		if e.Mark == StringPersist {
+			_, exist := k.expires[key]
+			if !exist && older && k.strIndex.index.Get(e.Meta.Key) != nil {
+				return e, nil
+			}
+			return nil, nil
+		}
+		var relocated []*index.Indexer
+		if idx := k.strIndex.index.Get(e.Meta.Key); idx != nil {
+			if idx.FileId == pos.fid && idx.Offset == pos.offset {
+				relocated = append(relocated, idx)
+			}
+		} else if e.Mark == StringRem && older {
+			return e, nil
+		}
+		// 只被快照引用的历史版本以快照标记写入, 重放时忽略
+		versions := history[pos]
+		if len(relocated) == 0 && len(versions) > 0 {
+			e = store.NewNoExtraEntry(e.Meta.Key, e.Meta.Value, String, StringSnapshot)
+		}
+		relocated = append(relocated, versions...)
+		if len(relocated) > 0 {
+			return e, relocated
+		}
+	case Hash:
+		// 字段的值可能为空, 需要单独判断字段是否存在
+		field := string(e.Meta.Extra)
+		exist := k.hashIndex.indexes.HExists(key, field)
+		if (e.Mark == HashHSet && exist && bytes.Equal(k.hashIndex.indexes.HGet(key, field), e.Meta.Value)) || (e.Mark == HashHDel && !exist && older) {
+			return e, nil
+		}
+	case Set:
+		exist := k.setIndex.indexes.SIsMember(key, e.Meta.Value)
+		if (e.Mark == SetSAdd && exist) || (e.Mark == SetSRem && !exist && older) {
+			return e, nil
+		}
+	case ZSet:
+		score, exist := k.zsetIndex.indexes.ZScore(key, e.Meta.Value)
+		if e.Mark == ZSetZAdd && exist {
+			if v, err := strconv.ParseFloat(string(e.Meta.Extra), 64); err == nil && v == score {
+				return e, nil
+			}
+		}
+		if e.Mark == ZSetZRem && !exist && older {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// 判断是否存在比fid更早的归档文件
+func (k *Kvstore) hasOlderFile(fid uint32) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for id := range k.archFiles {
+		if id < fid {
+			return true
+		}
+	}
+	return false
+}
+
+// 依次锁住各类型索引表
+func (k *Kvstore) lockIndexes() {
+	k.strIndex.lock()
+	k.hashIndex.mu.Lock()
+	k.listIndex.mu.Lock()
+	k.setIndex.mu.Lock()
+	k.zsetIndex.mu.Lock()
+}
+
+func (k *Kvstore) unlockIndexes() {
+	k.flushIndex()
+	k.zsetIndex.mu.Unlock()
+	k.setIndex.mu.Unlock()
+	k.listIndex.mu.Unlock()
+	k.hashIndex.mu.Unlock()
+	k.strIndex.unlock()
+}
+
+func (k *Kvstore) rLockIndexes() {
+	k.strIndex.mu.RLock()
+	k.hashIndex.mu.RLock()
+	k.listIndex.mu.RLock()
+	k.setIndex.mu.RLock()
+	k.zsetIndex.mu.RLock()
+}
+
+func (k *Kvstore) rUnlockIndexes() {
+	k.zsetIndex.mu.RUnlock()
+	k.setIndex.mu.RUnlock()
+	k.listIndex.mu.RUnlock()
+	k.hashIndex.mu.RUnlock()
+	k.strIndex.mu.RUnlock()
+}
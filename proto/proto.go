@@ -0,0 +1,218 @@
+package proto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 服务器的二进制协议
+//
+// 请求: 参数数量(4) + 每个参数的长度(4)和内容, 第一个参数为命令名
+// 回复: 状态码(1) + 内容, 不同状态码的内容如下
+//   StatusOK, StatusError, StatusBulk: 长度(4) + 内容
+//   StatusNil: 没有内容
+//   StatusInteger: 8字节整数
+//   StatusArray: 元素数量(4) + 每个元素的回复
+// 所有整数均为大端序
+
+var (
+	// ErrTooManyArgs 请求的参数数量超出限制
+	ErrTooManyArgs = errors.New("proto: too many arguments")
+
+	// ErrArgTooLarge 参数或回复内容超出长度限制
+	ErrArgTooLarge = errors.New("proto: argument too large")
+
+	// ErrInvalidStatus 未知的回复状态码
+	ErrInvalidStatus = errors.New("proto: invalid reply status")
+)
+
+const (
+	// MaxArgs 单条命令最多的参数数量, 参数数量的最高字节始终为0, 服务器据此与RESP协议区分
+	MaxArgs = 1024 * 1024
+
+	// MaxArgSize 单个参数或回复内容的最大长度
+	MaxArgSize = 512 * 1024 * 1024
+)
+
+// 回复的状态码
+const (
+	StatusOK byte = iota
+	StatusNil
+	StatusError
+	StatusInteger
+	StatusBulk
+	StatusArray
+)
+
+// WriteCommand 编码一条命令
+func WriteCommand(w *bufio.Writer, args ...[]byte) error {
+	if len(args) > MaxArgs {
+		return ErrTooManyArgs
+	}
+	writeUint32(w, uint32(len(args)))
+	for _, arg := range args {
+		if len(arg) > MaxArgSize {
+			return ErrArgTooLarge
+		}
+		writeUint32(w, uint32(len(arg)))
+		if _, err := w.Write(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCommand 读取一条命令, 连接在命令开始前关闭时返回io.EOF
+func ReadCommand(r *bufio.Reader) ([][]byte, error) {
+	n, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxArgs {
+		return nil, ErrTooManyArgs
+	}
+
+	args := make([][]byte, 0, n)
+	for i := uint32(0); i < n; i++ {
+		arg, err := readData(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// WriteReply 编码一条回复, 简单字符串以StatusOK返回, 键值对展开为数组, 浮点数以字符串返回
+func WriteReply(w *bufio.Writer, r Reply) error {
+	switch r.Type {
+	case StatusReply:
+		return writeData(w, StatusOK, r.Str)
+	case ErrorReply:
+		return writeData(w, StatusError, r.Str)
+	case IntegerReply:
+		if err := w.WriteByte(StatusInteger); err != nil {
+			return err
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(r.Int))
+		_, err := w.Write(buf)
+		return err
+	case BulkReply, DoubleReply:
+		return writeData(w, StatusBulk, r.Str)
+	case NilReply:
+		return w.WriteByte(StatusNil)
+	case ArrayReply, MapReply:
+		if err := w.WriteByte(StatusArray); err != nil {
+			return err
+		}
+		writeUint32(w, uint32(len(r.Elems)))
+		for _, e := range r.Elems {
+			if err := WriteReply(w, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrInvalidStatus
+}
+
+// ReadReply 读取一条回复
+func ReadReply(r *bufio.Reader) (Reply, error) {
+	status, err := r.ReadByte()
+	if err != nil {
+		return Reply{}, err
+	}
+
+	switch status {
+	case StatusOK, StatusError, StatusBulk:
+		data, err := readData(r)
+		if err != nil {
+			return Reply{}, unexpectedEOF(err)
+		}
+		res := Reply{Type: BulkReply, Str: string(data)}
+		if status == StatusOK {
+			res.Type = StatusReply
+		} else if status == StatusError {
+			res.Type = ErrorReply
+		}
+		return res, nil
+	case StatusNil:
+		return Reply{Type: NilReply}, nil
+	case StatusInteger:
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return Reply{}, unexpectedEOF(err)
+		}
+		return Reply{Type: IntegerReply, Int: int64(binary.BigEndian.Uint64(buf))}, nil
+	case StatusArray:
+		n, err := readUint32(r)
+		if err != nil {
+			return Reply{}, unexpectedEOF(err)
+		}
+		if n > MaxArgs {
+			return Reply{}, ErrTooManyArgs
+		}
+		res := Reply{Type: ArrayReply, Elems: make([]Reply, 0, n)}
+		for i := uint32(0); i < n; i++ {
+			e, err := ReadReply(r)
+			if err != nil {
+				return Reply{}, unexpectedEOF(err)
+			}
+			res.Elems = append(res.Elems, e)
+		}
+		return res, nil
+	}
+	return Reply{}, fmt.Errorf("%w %d", ErrInvalidStatus, status)
+}
+
+func writeUint32(w *bufio.Writer, n uint32) {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, n)
+	_, _ = w.Write(buf)
+}
+
+func writeData(w *bufio.Writer, status byte, s string) error {
+	if len(s) > MaxArgSize {
+		return ErrArgTooLarge
+	}
+	_ = w.WriteByte(status)
+	writeUint32(w, uint32(len(s)))
+	_, err := w.WriteString(s)
+	return err
+}
+
+func readUint32(r *bufio.Reader) (uint32, error) {
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf), nil
+}
+
+// 读取长度和内容
+func readData(r *bufio.Reader) ([]byte, error) {
+	size, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxArgSize {
+		return nil, ErrArgTooLarge
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 读取到一半时连接关闭
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
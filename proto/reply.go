@@ -0,0 +1,59 @@
+package proto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ReplyType 回复的类型, 与RESP的回复类型对应
+type ReplyType byte
+
+const (
+	// StatusReply 简单字符串, 如OK
+	StatusReply ReplyType = iota
+	// ErrorReply 错误信息
+	ErrorReply
+	// IntegerReply 整数
+	IntegerReply
+	// BulkReply 二进制安全的字符串
+	BulkReply
+	// NilReply 空值, 如键不存在
+	NilReply
+	// ArrayReply 数组
+	ArrayReply
+	// MapReply 键值对, 元素按键值交替排列, RESP2中以数组返回
+	MapReply
+	// DoubleReply 浮点数, RESP2中以字符串返回
+	DoubleReply
+)
+
+// Reply 命令的执行结果
+type Reply struct {
+	Type ReplyType
+	// 简单字符串, 错误信息, 字符串和浮点数的内容
+	Str string
+	// 整数的值
+	Int int64
+	// 数组和键值对的元素
+	Elems []Reply
+}
+
+// String 转化为文本, 多个元素按行拼接
+func (r Reply) String() string {
+	switch r.Type {
+	case ErrorReply:
+		return fmt.Sprintf("err : %s", r.Str)
+	case IntegerReply:
+		return strconv.FormatInt(r.Int, 10)
+	case NilReply:
+		return "(nil)"
+	case ArrayReply, MapReply:
+		lines := make([]string, 0, len(r.Elems))
+		for _, e := range r.Elems {
+			lines = append(lines, e.String())
+		}
+		return strings.Join(lines, "\n")
+	}
+	return r.Str
+}
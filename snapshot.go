@@ -0,0 +1,189 @@
+package kvstore
+
+import (
+	"errors"
+	"kvstore/index"
+)
+
+// ErrSnapshotClosed 快照已经关闭
+var ErrSnapshotClosed = errors.New("kvstore: snapshot is closed")
+
+// Snapshot 字符串索引表的只读快照, 读取的结果与建立快照时一致
+// 快照打开期间被修改或删除的键会保留历史版本, 关闭快照后释放
+type Snapshot struct {
+	kv *Kvstore
+	// 建立快照时的版本号
+	seq uint64
+	// 建立快照时的时间, 以毫秒为单位, 用于判断键是否过期
+	ts     uint64
+	closed bool
+}
+
+// 字符串键的历史版本, 在版本号达到replaced之前可见
+type strVersion struct {
+	// 被替换时的版本号
+	replaced uint64
+	// 索引信息, 为空表示键不存在
+	idx *index.Indexer
+	// 过期时间
+	deadline uint64
+}
+
+// Snapshot 建立快照, 使用完毕后需要调用Close释放历史版本
+func (k *Kvstore) Snapshot() *Snapshot {
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+
+	s := &Snapshot{kv: k, seq: k.strIndex.seq, ts: k.now()}
+	k.strIndex.snapshots[s] = struct{}{}
+	return s
+}
+
+// Get 获取建立快照时的str数据
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	k := s.kv
+	// 判断key是否合法
+	if err := k.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	// 加锁, closed在持有写锁时修改, 需要在加锁之后判断
+	k.strIndex.mu.RLock()
+	defer k.strIndex.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrSnapshotClosed
+	}
+	idx := s.lookup(key)
+	if idx == nil {
+		return nil, ErrKeyNotExist
+	}
+	return k.getValue(idx)
+}
+
+// NewIterator 建立遍历快照的迭代器
+func (s *Snapshot) NewIterator(opts IteratorOptions) *Iterator {
+	it := &Iterator{kv: s.kv, snap: s, opts: opts}
+	if s.isClosed() {
+		it.Close()
+		return it
+	}
+	it.Rewind()
+	return it
+}
+
+// Close 关闭快照, 释放不再被引用的历史版本
+func (s *Snapshot) Close() {
+	k := s.kv
+	k.strIndex.lock()
+	defer k.strIndex.unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(k.strIndex.snapshots, s)
+
+	// 没有快照时清空所有历史版本
+	if len(k.strIndex.snapshots) == 0 {
+		k.strIndex.history = index.InitSkl()
+		return
+	}
+
+	// 只保留最早的快照仍然可见的历史版本
+	min := k.strIndex.seq
+	for snap := range k.strIndex.snapshots {
+		if snap.seq < min {
+			min = snap.seq
+		}
+	}
+	var empty [][]byte
+	for node := k.strIndex.history.Front(); node != nil; node = node.Next() {
+		versions := node.Value().([]*strVersion)
+		i := 0
+		for i < len(versions) && versions[i].replaced <= min {
+			i++
+		}
+		if i == len(versions) {
+			empty = append(empty, node.Key())
+		} else if i > 0 {
+			k.strIndex.history.Insert(node.Key(), versions[i:])
+		}
+	}
+	for _, key := range empty {
+		k.strIndex.history.Remove(key)
+	}
+}
+
+// 判断快照是否已经关闭
+func (s *Snapshot) isClosed() bool {
+	s.kv.strIndex.mu.RLock()
+	defer s.kv.strIndex.mu.RUnlock()
+	return s.closed
+}
+
+// 查找键在快照中的索引信息, 不存在或已过期时返回空, 调用方需持有字符串索引表的锁
+func (s *Snapshot) lookup(key []byte) *index.Indexer {
+	k := s.kv
+	var idx *index.Indexer
+	var deadline uint64
+
+	found := false
+	if node := k.strIndex.history.Find(key); node != nil {
+		// 第一个在快照之后被替换的版本即为快照可见的版本
+		for _, v := range node.Value().([]*strVersion) {
+			if v.replaced > s.seq {
+				idx, deadline, found = v.idx, v.deadline, true
+				break
+			}
+		}
+	}
+	if !found {
+		if idx = k.strIndex.index.Get(key); idx != nil {
+			deadline = k.expires[string(key)]
+		}
+	}
+
+	// 以建立快照的时间判断是否过期
+	if idx == nil || (deadline > 0 && deadline <= s.ts) {
+		return nil
+	}
+	return idx
+}
+
+// 修改字符串键之前调用, 有快照时保存键的当前版本, 调用方需持有字符串索引表的锁
+func (k *Kvstore) saveVersion(key []byte) {
+	k.strIndex.seq++
+	if len(k.strIndex.snapshots) == 0 {
+		return
+	}
+
+	v := &strVersion{replaced: k.strIndex.seq, deadline: k.expires[string(key)]}
+	v.idx = k.strIndex.index.Get(key)
+
+	var versions []*strVersion
+	if node := k.strIndex.history.Find(key); node != nil {
+		versions = node.Value().([]*strVersion)
+	}
+	k.strIndex.history.Insert(append([]byte{}, key...), append(versions, v))
+}
+
+// 历史版本在文件中的位置, 用于重写数据库文件时保留被快照引用的数据条
+type entryPos struct {
+	fid    uint32
+	offset int64
+}
+
+// 返回被快照引用的历史版本, 按所在位置分组, 调用方需持有字符串索引表的锁
+func (k *Kvstore) historyPositions() map[entryPos][]*index.Indexer {
+	res := make(map[entryPos][]*index.Indexer)
+	for node := k.strIndex.history.Front(); node != nil; node = node.Next() {
+		for _, v := range node.Value().([]*strVersion) {
+			if v.idx != nil {
+				pos := entryPos{fid: v.idx.FileId, offset: v.idx.Offset}
+				res[pos] = append(res[pos], v.idx)
+			}
+		}
+	}
+	return res
+}
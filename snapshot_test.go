@@ -0,0 +1,46 @@
+package kvstore
+
+import (
+	"sync"
+	"testing"
+)
+
+// 需要配合-race运行, 读取和关闭快照同时进行时不能有数据竞争
+func TestSnapshotConcurrentClose(t *testing.T) {
+	config := testConfig(t)
+	kv := openTestKv(t, config)
+	defer kv.Close()
+	if err := kv.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		snap := kv.Snapshot()
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				v, err := snap.Get([]byte("k"))
+				if err != nil && err != ErrSnapshotClosed {
+					t.Error(err)
+					return
+				}
+				if err == nil && string(v) != "v" {
+					t.Errorf("get: got %q, want %q", v, "v")
+					return
+				}
+				it := snap.NewIterator(IteratorOptions{})
+				it.Close()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			snap.Close()
+		}()
+		wg.Wait()
+		if _, err := snap.Get([]byte("k")); err != ErrSnapshotClosed {
+			t.Fatalf("get after close: got %v, want %v", err, ErrSnapshotClosed)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package kvstore
+
+import (
+	"kvstore/index"
+	"kvstore/store"
+	"sort"
+	"sync"
+)
+
+// DataFileStats 数据文件的统计信息
+type DataFileStats struct {
+	// Id 文件id
+	Id uint32
+	// Active 是否为当前活跃文件
+	Active bool
+	// Size 写入的数据大小
+	Size int64
+	// Garbage 已经失效的数据大小
+	Garbage int64
+}
+
+// GarbageRatio 失效数据所占的比例
+func (s DataFileStats) GarbageRatio() float64 {
+	if s.Size == 0 {
+		return 0
+	}
+	return float64(s.Garbage) / float64(s.Size)
+}
+
+// Stats 数据库统计信息
+type Stats struct {
+	// DataFiles 按id排列的数据文件统计信息
+	DataFiles []DataFileStats
+	// Size 所有数据文件写入的数据大小
+	Size int64
+	// Garbage 所有数据文件中已经失效的数据大小
+	Garbage int64
+}
+
+// 各数据文件的垃圾数据统计
+// 字符串的entry在被覆盖, 删除或过期时记为失效, 删除标记和批量写入标记写入时即记为失效,
+// 其他类型的entry和过期时间失效时无法知道原来的位置, 只统计其大小, 合并前读取文件计算实际的比例
+type garbageStats struct {
+	mu    sync.Mutex
+	files store.FileStats
+}
+
+func newGarbageStats() *garbageStats {
+	return &garbageStats{files: make(store.FileStats)}
+}
+
+// Stats 返回数据库统计信息
+func (k *Kvstore) Stats() Stats {
+	k.mu.RLock()
+	activeFileId := k.activeFileId
+	k.mu.RUnlock()
+
+	k.stats.mu.Lock()
+	defer k.stats.mu.Unlock()
+
+	var s Stats
+	for fid, st := range k.stats.files {
+		s.DataFiles = append(s.DataFiles, DataFileStats{
+			Id: fid,
+			Active: fid == activeFileId,
+			Size: st.Total,
+			Garbage: st.Garbage,
+		})
+		s.Size += st.Total
+		s.Garbage += st.Garbage
+	}
+	sort.Slice(s.DataFiles, func(i, j int) bool {
+		return s.DataFiles[i].Id < s.DataFiles[j].Id
+	})
+	return s
+}
+
+// 记录写入文件的entry, 写入时即失效的entry同时记为垃圾数据
+func (k *Kvstore) countEntry(idx *index.Indexer, e *store.Entry) {
+	k.stats.mu.Lock()
+	defer k.stats.mu.Unlock()
+
+	countStat(k.stats.file(idx.FileId), e, int64(idx.EntrySize))
+}
+
+// 累加entry的大小, 写入时即失效的记为垃圾数据, 失效时不会记为垃圾数据的单独统计
+func countStat(st *store.FileStat, e *store.Entry, size int64) {
+	st.Total += size
+	if deadEntry(e) {
+		st.Garbage += size
+	} else if !trackedEntry(e) {
+		st.Untracked += size
+	}
+}
+
+// 将索引信息指向的entry记为垃圾数据
+func (k *Kvstore) addGarbage(idx *index.Indexer) {
+	k.stats.mu.Lock()
+	defer k.stats.mu.Unlock()
+
+	st := k.stats.file(idx.FileId)
+	st.Garbage += int64(idx.EntrySize)
+	if st.Garbage > st.Total {
+		st.Garbage = st.Total
+	}
+}
+
+// 返回数据文件的垃圾数据比例, 调用方需持有k.stats.mu
+func (s *garbageStats) ratio(fid uint32) float64 {
+	st, exist := s.files[fid]
+	if !exist || st.Total == 0 {
+		return 0
+	}
+	return float64(st.Garbage) / float64(st.Total)
+}
+
+// 返回数据文件的垃圾数据比例的上限, 即无法跟踪的数据全部失效时的比例, 调用方需持有k.stats.mu
+func (s *garbageStats) maxRatio(fid uint32) float64 {
+	st, exist := s.files[fid]
+	if !exist || st.Total == 0 {
+		return 0
+	}
+	return float64(st.Garbage+st.Untracked) / float64(st.Total)
+}
+
+// 返回数据文件的统计信息, 不存在时新建, 调用方需持有k.stats.mu
+func (s *garbageStats) file(fid uint32) *store.FileStat {
+	st, exist := s.files[fid]
+	if !exist {
+		st = &store.FileStat{}
+		s.files[fid] = st
+	}
+	return st
+}
+
+// 合并重放统计的结果和上次关闭时保存的结果
+// 过期等不写入文件的失效无法通过重放得到, 因此失效数据取两者中较大的值
+func (k *Kvstore) loadStats() error {
+	saved, err := store.LoadFileStats(k.config.DirPath + store.PathSeparator + store.StatsFileName)
+	if err != nil {
+		return err
+	}
+
+	k.stats.mu.Lock()
+	defer k.stats.mu.Unlock()
+	for fid, st := range k.stats.files {
+		if old, exist := saved[fid]; exist && old.Total == st.Total && old.Garbage > st.Garbage {
+			st.Garbage = old.Garbage
+		}
+	}
+	return nil
+}
+
+// 保存统计信息
+func (k *Kvstore) saveStats() error {
+	k.stats.mu.Lock()
+	defer k.stats.mu.Unlock()
+	return k.stats.files.SaveFileStats(k.config.DirPath + store.PathSeparator + store.StatsFileName)
+}
+
+// 判断entry写入时是否即为失效数据
+func deadEntry(e *store.Entry) bool {
+	switch e.Type {
+	case String:
+		return e.Mark == StringRem || e.Mark == StringSnapshot
+	case Hash:
+		return e.Mark == HashHDel
+	case Set:
+		return e.Mark == SetSRem
+	case ZSet:
+		return e.Mark == ZSetZRem
+	case Batch:
+		return true
+	}
+	return false
+}
+
+// 判断entry失效时是否会记为垃圾数据, 只有字符串的值在被覆盖, 删除或过期时记录
+func trackedEntry(e *store.Entry) bool {
+	return e.Type == String && e.Mark == StringSet
+}
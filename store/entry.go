@@ -77,12 +77,22 @@ func (e *Entry) Encode() ([]byte, error) {
 		copy(buf[entryHeaderSize+ks+vs:entryHeaderSize+ks+vs+es], e.Meta.Extra)
 	}
 
-	// 校验和crc32
-	crc := crc32.ChecksumIEEE(e.Meta.Value)
+	// 校验和crc32, 覆盖校验和之后的头部, 键, 值和额外信息
+	crc := crc32.ChecksumIEEE(buf[4:])
 	binary.BigEndian.PutUint32(buf[:4], crc)
 	return buf, nil
 }
 
+// 检查校验和, header为编码后的头部
+// 旧格式的数据文件中校验和可能只覆盖值, legacy为true时也接受这种校验和
+func (e *Entry) verify(header []byte, legacy bool) bool {
+	crc := crc32.ChecksumIEEE(header[4:entryHeaderSize])
+	crc = crc32.Update(crc, crc32.IEEETable, e.Meta.Key)
+	crc = crc32.Update(crc, crc32.IEEETable, e.Meta.Value)
+	crc = crc32.Update(crc, crc32.IEEETable, e.Meta.Extra)
+	return crc == e.crc32 || (legacy && crc32.ChecksumIEEE(e.Meta.Value) == e.crc32)
+}
+
 // Decode 返回解码得到的entry
 func Decode(buf []byte) (*Entry, error) {
 	crc := binary.BigEndian.Uint32(buf[:4])
@@ -6,56 +6,22 @@ import (
 	"os"
 )
 
+// 旧版本过期字典文件中每条数据的头部大小
 const expiresHeadSize = 12
 
+// Expires 过期字典, 键 -> 以毫秒为单位的过期时间
 type Expires map[string]uint64
 
 type element struct {
-	Key []byte
-	KeySize uint32
+	Key      []byte
+	KeySize  uint32
 	Deadline uint64
 }
 
-// SaveExpires 保存过期字典
-func (e Expires) SaveExpires(path string) error {
-	// 打开给定路径的文件
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, FilePerm)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// 偏移量
-	var offset int64 = 0
-
-	// 遍历过期字典， 对于每条数据按一定的格式写入文件
-	for k, v := range e {
-		key := []byte(k)
-		deadline := v
-		buf := make([]byte, len(key)+expiresHeadSize)
-		// 前12字节写入数据头
-		binary.BigEndian.PutUint32(buf[:4], uint32(len(key)))
-		binary.BigEndian.PutUint64(buf[4:12], deadline)
-		copy(buf[12:], key)
-
-		// 将该条数据写入文件
-		_, err = file.WriteAt(buf, offset)
-		if err != nil {
-			return err
-		}
-
-		// 更新偏移地址
-		offset += int64(expiresHeadSize+len(key))
-	}
-
-	// 返回
-	return nil
-}
-
-// LoadExpires 加载过期字典
+// LoadExpires 加载旧版本保存的过期字典, 过期时间以秒为单位, 只用于迁移到数据文件
 func LoadExpires(path string) (Expires, error) {
-	// 按照给定路径打开文件
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, FilePerm)
+	// 按照给定路径打开文件, 不存在时返回错误
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
@@ -66,16 +32,15 @@ func LoadExpires(path string) (Expires, error) {
 
 	// 读取数据文件直到文件末尾或者错误发生
 	for {
-		if ele, err := readExpires(file, offset); err == nil {
-			key := string(ele.Key)
-			expires[key] = ele.Deadline
-			offset += int64(ele.KeySize + expiresHeadSize)
-		} else {
-			if err == io.EOF {
-				break
-			}
+		ele, err := readExpires(file, offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
 			return nil, err
 		}
+		expires[string(ele.Key)] = ele.Deadline
+		offset += int64(ele.KeySize + expiresHeadSize)
 	}
 
 	// 返回
@@ -85,8 +50,7 @@ func LoadExpires(path string) (Expires, error) {
 // 读取文件并解码
 func readExpires(file *os.File, offset int64) (*element, error) {
 	buf := make([]byte, expiresHeadSize)
-	_, err := file.ReadAt(buf, offset)
-	if err != nil {
+	if _, err := file.ReadAt(buf, offset); err != nil {
 		return nil, err
 	}
 
@@ -95,16 +59,13 @@ func readExpires(file *os.File, offset int64) (*element, error) {
 	ele.Deadline = binary.BigEndian.Uint64(buf[4:12])
 
 	key := make([]byte, ele.KeySize)
-	_, err = file.ReadAt(key, offset+expiresHeadSize)
-	if err != nil {
+	if _, err := file.ReadAt(key, offset+expiresHeadSize); err != nil {
+		// 数据头完整而键不完整时视为文件损坏
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, err
 	}
 	ele.Key = key
-	return ele, err
+	return ele, nil
 }
-
-
-
-
-
-
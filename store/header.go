@@ -0,0 +1,129 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// ErrLegacyFormat 数据文件没有文件头, 需要使用kvstore-migrate升级
+	ErrLegacyFormat = errors.New("data file has no format header, upgrade it with kvstore-migrate")
+
+	// ErrInvalidFileHeader 文件头损坏
+	ErrInvalidFileHeader = errors.New("invalid data file header")
+
+	// ErrUnsupportedVersion 文件格式版本高于当前支持的版本
+	ErrUnsupportedVersion = errors.New("unsupported data file format version")
+
+	// ErrFileIdMismatch 文件头记录的文件id与文件名不一致
+	ErrFileIdMismatch = errors.New("file id in header does not match file name")
+
+	// ErrBlockSizeMismatch 文件头记录的文件大小上限与配置不一致
+	ErrBlockSizeMismatch = errors.New("block size in header does not match config")
+)
+
+const (
+	// FileMagic 数据文件魔数 "KVSF"
+	FileMagic uint32 = 0x4b565346
+
+	// FormatVersion 当前的数据文件格式版本
+	// 版本0为没有文件头的旧格式, 校验和只覆盖值
+	FormatVersion uint16 = 1
+
+	// FileHeaderSize 文件头大小: magic(4) + version(2) + flags(2) + fid(4) + blockSize(8) + createdAt(8) + crc(4)
+	// 文件中的entry从文件头之后开始
+	FileHeaderSize = 32
+)
+
+const (
+	// FlagMmap 文件以mmap模式创建, 预先分配了blockSize大小的空间
+	FlagMmap uint16 = 1 << iota
+)
+
+// FileHeader 数据文件头
+type FileHeader struct {
+	Version   uint16
+	Flags     uint16
+	FileId    uint32
+	BlockSize int64
+	CreatedAt int64
+}
+
+func newFileHeader(fid uint32, method FileRwMethod, blockSize int64) *FileHeader {
+	h := &FileHeader{
+		Version:   FormatVersion,
+		FileId:    fid,
+		BlockSize: blockSize,
+		CreatedAt: time.Now().Unix(),
+	}
+	if method == MmapIO {
+		h.Flags |= FlagMmap
+	}
+	return h
+}
+
+// Encode 编码文件头
+func (h *FileHeader) Encode() []byte {
+	buf := make([]byte, FileHeaderSize)
+	binary.BigEndian.PutUint32(buf[0:4], FileMagic)
+	binary.BigEndian.PutUint16(buf[4:6], h.Version)
+	binary.BigEndian.PutUint16(buf[6:8], h.Flags)
+	binary.BigEndian.PutUint32(buf[8:12], h.FileId)
+	binary.BigEndian.PutUint64(buf[12:20], uint64(h.BlockSize))
+	binary.BigEndian.PutUint64(buf[20:28], uint64(h.CreatedAt))
+	binary.BigEndian.PutUint32(buf[28:32], crc32.ChecksumIEEE(buf[:28]))
+	return buf
+}
+
+// DecodeFileHeader 解码文件头, 没有魔数时返回ErrLegacyFormat
+func DecodeFileHeader(buf []byte) (*FileHeader, error) {
+	if len(buf) < FileHeaderSize || binary.BigEndian.Uint32(buf[0:4]) != FileMagic {
+		return nil, ErrLegacyFormat
+	}
+	if crc32.ChecksumIEEE(buf[:28]) != binary.BigEndian.Uint32(buf[28:32]) {
+		return nil, ErrInvalidFileHeader
+	}
+
+	h := &FileHeader{
+		Version:   binary.BigEndian.Uint16(buf[4:6]),
+		Flags:     binary.BigEndian.Uint16(buf[6:8]),
+		FileId:    binary.BigEndian.Uint32(buf[8:12]),
+		BlockSize: int64(binary.BigEndian.Uint64(buf[12:20])),
+		CreatedAt: int64(binary.BigEndian.Uint64(buf[20:28])),
+	}
+	if h.Version == 0 || h.Version > FormatVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	// 返回
+	return h, nil
+}
+
+// 读取并检查文件头, 空文件返回空
+func readFileHeader(f *os.File, fid uint32, blockSize int64) (*FileHeader, error) {
+	buf := make([]byte, FileHeaderSize)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// 新建的文件, mmap模式下为预先分配的零字节
+	if isZero(buf[:n]) {
+		return nil, nil
+	}
+
+	h, err := DecodeFileHeader(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	if h.FileId != fid {
+		return nil, ErrFileIdMismatch
+	}
+	if h.BlockSize != blockSize {
+		return nil, ErrBlockSizeMismatch
+	}
+	return h, nil
+}
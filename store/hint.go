@@ -0,0 +1,138 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	// ErrInvalidHint 索引文件损坏或与数据文件不匹配
+	ErrInvalidHint = errors.New("invalid hint file")
+)
+
+const (
+	// HintFileNameFormat 索引文件名称格式, 与数据文件一一对应
+	HintFileNameFormat = "%06d.hint"
+
+	// 每条索引记录的头部大小: fid(4) + offset(8) + entrySize(4) + type(2) + mark(2) + keySize(4)
+	hintHeaderSize = 24
+
+	// 索引文件尾部: 数据文件有效长度(8) + 校验和(4)
+	hintFooterSize = 12
+)
+
+// Hint 数据文件中一条entry的位置信息, 不包含值
+type Hint struct {
+	Key       []byte
+	FileId    uint32
+	Offset    int64
+	EntrySize uint32
+	Type      uint16
+	Mark      uint16
+}
+
+// NewHint 根据entry及其写入位置建立索引记录
+func NewHint(e *Entry, fid uint32, offset int64) *Hint {
+	return &Hint{
+		Key:       e.Meta.Key,
+		FileId:    fid,
+		Offset:    offset,
+		EntrySize: e.Size(),
+		Type:      e.Type,
+		Mark:      e.Mark,
+	}
+}
+
+// HintPath 返回数据文件对应的索引文件路径
+func HintPath(path string, fid uint32) string {
+	return path + PathSeparator + fmt.Sprintf(HintFileNameFormat, fid)
+}
+
+// SaveHints 保存索引文件, 先写入临时文件再重命名, 避免留下写了一半的索引文件
+func SaveHints(path string, fid uint32, hints []*Hint) error {
+	size := hintFooterSize
+	for _, h := range hints {
+		size += hintHeaderSize + len(h.Key)
+	}
+
+	buf := make([]byte, size)
+	var offset int64
+	end := int64(FileHeaderSize)
+	for _, h := range hints {
+		binary.BigEndian.PutUint32(buf[offset:offset+4], h.FileId)
+		binary.BigEndian.PutUint64(buf[offset+4:offset+12], uint64(h.Offset))
+		binary.BigEndian.PutUint32(buf[offset+12:offset+16], h.EntrySize)
+		binary.BigEndian.PutUint16(buf[offset+16:offset+18], h.Type)
+		binary.BigEndian.PutUint16(buf[offset+18:offset+20], h.Mark)
+		binary.BigEndian.PutUint32(buf[offset+20:offset+24], uint32(len(h.Key)))
+		copy(buf[offset+hintHeaderSize:], h.Key)
+		offset += hintHeaderSize + int64(len(h.Key))
+		end = h.Offset + int64(h.EntrySize)
+	}
+
+	// 尾部记录数据文件有效长度和校验和
+	binary.BigEndian.PutUint64(buf[offset:offset+8], uint64(end))
+	binary.BigEndian.PutUint32(buf[offset+8:], crc32.ChecksumIEEE(buf[:offset+8]))
+
+	tmp := HintPath(path, fid) + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, FilePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, HintPath(path, fid))
+}
+
+// LoadHints 加载索引文件, 同时返回数据文件的有效长度
+func LoadHints(path string, fid uint32) ([]*Hint, int64, error) {
+	buf, err := ioutil.ReadFile(HintPath(path, fid))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(buf) < hintFooterSize {
+		return nil, 0, ErrInvalidHint
+	}
+
+	// 检查校验和
+	body := len(buf) - hintFooterSize
+	if crc32.ChecksumIEEE(buf[:body+8]) != binary.BigEndian.Uint32(buf[body+8:]) {
+		return nil, 0, ErrInvalidHint
+	}
+	end := int64(binary.BigEndian.Uint64(buf[body : body+8]))
+
+	var hints []*Hint
+	for offset := 0; offset < body; {
+		if offset+hintHeaderSize > body {
+			return nil, 0, ErrInvalidHint
+		}
+		h := &Hint{
+			FileId:    binary.BigEndian.Uint32(buf[offset : offset+4]),
+			Offset:    int64(binary.BigEndian.Uint64(buf[offset+4 : offset+12])),
+			EntrySize: binary.BigEndian.Uint32(buf[offset+12 : offset+16]),
+			Type:      binary.BigEndian.Uint16(buf[offset+16 : offset+18]),
+			Mark:      binary.BigEndian.Uint16(buf[offset+18 : offset+20]),
+		}
+		ks := int(binary.BigEndian.Uint32(buf[offset+20 : offset+24]))
+		offset += hintHeaderSize
+		if offset+ks > body || h.FileId != fid {
+			return nil, 0, ErrInvalidHint
+		}
+		h.Key = append([]byte{}, buf[offset:offset+ks]...)
+		offset += ks
+		hints = append(hints, h)
+	}
+
+	// 返回
+	return hints, end, nil
+}
+
+// RemoveHints 删除数据文件对应的索引文件
+func RemoveHints(path string, fid uint32) error {
+	err := os.Remove(HintPath(path, fid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/roseduan/mmap-go"
-	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"os"
 	"sort"
@@ -14,6 +14,9 @@ import (
 
 var (
 	ErrEmptyEntry = errors.New("entry or the key of entry is empty")
+
+	// ErrEntryTooLarge entry超出了数据文件的范围, 通常是头部损坏
+	ErrEntryTooLarge = errors.New("entry exceeds the data file")
 )
 
 const (
@@ -38,6 +41,8 @@ type KvFile struct {
 	Id     uint32 // 数据库文件id
 	path   string // 文件路径
 	method FileRwMethod //读写文件方式
+	blockSize int64 // 文件大小上限
+	version uint16 // 文件格式版本
 	File   *os.File //普通读写文件方式
 	Offset int64 // 偏移地址
 	Mp mmap.MMap // 增加了mmap模式
@@ -52,11 +57,16 @@ func NewKvFile(path string, fid uint32, method FileRwMethod, blockSize int64) (*
 		return nil, err
 	}
 
-	kf := &KvFile{Id: fid, path: path, method: method, Offset: 0}
+	// 检查文件头, 避免以错误的格式读写数据文件
+	header, err := readFileHeader(f, fid, blockSize)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", filepath, err)
+	}
 
-	if kf.method == FileIO {
-		kf.File = f
-	} else {
+	kf := &KvFile{Id: fid, path: path, method: method, blockSize: blockSize, version: FormatVersion, Offset: FileHeaderSize, File: f}
+
+	if kf.method == MmapIO {
 		if err := f.Truncate(blockSize); err != nil {
 			return nil, err
 		}
@@ -67,22 +77,58 @@ func NewKvFile(path string, fid uint32, method FileRwMethod, blockSize int64) (*
 		kf.Mp = m
 	}
 
+	// 新建的文件写入文件头
+	if header == nil {
+		buf := newFileHeader(fid, method, blockSize).Encode()
+		if kf.method == MmapIO {
+			copy(kf.Mp, buf)
+		} else if _, err := f.WriteAt(buf, 0); err != nil {
+			return nil, err
+		}
+	}
+
 	// 返回
 	return kf, nil
 }
 
+// OpenLegacyKvFile 以只读方式打开没有文件头的旧格式数据文件, 用于升级数据文件格式
+func OpenLegacyKvFile(path string, fid uint32) (*KvFile, error) {
+	filepath := path + PathSeparator + fmt.Sprintf(DbFileNameFormat, fid)
+
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// 返回
+	return &KvFile{Id: fid, path: path, method: FileIO, blockSize: info.Size(), Offset: 0, File: f}, nil
+}
+
 // 数据库文件读操作
 func (kf *KvFile) Read(offset int64) (e *Entry, err error) {
-	var buf []byte
 	// 解码entry， 返回一个只包含head的entry
-	buf, err = kf.rebuff(offset, int64(entryHeaderSize))
+	header, err := kf.rebuff(offset, int64(entryHeaderSize))
 	if err != nil {
 		return
 	}
-	e, err = Decode(buf)
+	// 全零的头部表示之后没有数据, mmap模式下文件是预先分配的
+	if isZero(header) {
+		return nil, io.EOF
+	}
+	e, err = Decode(header)
 	if err != nil {
 		return
 	}
+	// 损坏的头部可能记录了很大的长度, 先检查再读取
+	size := int64(entryHeaderSize) + int64(e.Meta.KeySize) + int64(e.Meta.ValueSize) + int64(e.Meta.ExtraSize)
+	if offset+size > kf.blockSize {
+		return nil, ErrEntryTooLarge
+	}
 
 	offset += entryHeaderSize
 	// 解码Meta中的key
@@ -115,8 +161,7 @@ func (kf *KvFile) Read(offset int64) (e *Entry, err error) {
 	}
 
 	// 检查结果
-	checkCrc32 := crc32.ChecksumIEEE(e.Meta.Value)
-	if checkCrc32 != e.crc32 {
+	if !e.verify(header, kf.version == 0) {
 		return nil, ErrInValidCrc
 	}
 
@@ -124,22 +169,76 @@ func (kf *KvFile) Read(offset int64) (e *Entry, err error) {
 	return e, err
 }
 
+// 读取n个字节, 从offset开始没有数据时返回io.EOF, 文件读写模式下数据不完整时返回io.ErrUnexpectedEOF
 func (kf *KvFile) rebuff(offset int64, n int64) ([]byte, error) {
 	buf := make([]byte, n)
 
 	if kf.method == FileIO {
-		_, err := kf.File.ReadAt(buf, offset)
+		read, err := kf.File.ReadAt(buf, offset)
+		if err == io.EOF && read > 0 {
+			err = io.ErrUnexpectedEOF
+		}
 		if err != nil {
 			return nil, err
 		}
 	}
-	if kf.method == MmapIO && offset <= int64(len(kf.Mp)) {
+	// 映射区域末尾不足n个字节时以零填充, 由调用方根据头部判断是否结束
+	if kf.method == MmapIO {
+		if offset >= int64(len(kf.Mp)) {
+			return nil, io.EOF
+		}
 		copy(buf, kf.Mp[offset:])
 	}
 	// 返回结果
 	return buf, nil
 }
 
+// TailSize 返回offset之后残留的数据大小, mmap模式下不计算末尾预先分配的零字节
+func (kf *KvFile) TailSize(offset int64) (int64, error) {
+	if kf.method == MmapIO {
+		end := int64(len(kf.Mp))
+		for end > offset && kf.Mp[end-1] == 0 {
+			end--
+		}
+		return end - offset, nil
+	}
+
+	info, err := kf.File.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < offset {
+		return 0, nil
+	}
+	return info.Size() - offset, nil
+}
+
+// Truncate 丢弃offset之后的数据, 之后从offset处继续写入
+func (kf *KvFile) Truncate(offset int64) error {
+	if kf.method == MmapIO {
+		for i := offset; i < int64(len(kf.Mp)); i++ {
+			kf.Mp[i] = 0
+		}
+		if err := kf.Mp.Flush(); err != nil {
+			return err
+		}
+	} else if err := kf.File.Truncate(offset); err != nil {
+		return err
+	}
+	kf.Offset = offset
+	return nil
+}
+
+// 判断是否全部为零字节
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // 从文件偏移处写入数据
 func (kf *KvFile) Write(e *Entry) error {
 	if e == nil || e.Meta.KeySize == 0 {
@@ -165,14 +264,14 @@ func (kf *KvFile) Write(e *Entry) error {
 	return nil
 }
 
-// Sync 同步文件
+// Sync 同步文件, mmap模式下将映射区域刷新到磁盘, 文件仍然可以继续读写
 func (kf * KvFile) Sync() (err error) {
+	if kf.Mp != nil {
+		return kf.Mp.Flush()
+	}
 	if kf.File != nil {
 		err = kf.File.Sync()
 	}
-	if kf.Mp != nil {
-		err = kf.Mp.Unmap()
-	}
 	return
 }
 
@@ -185,12 +284,15 @@ func (kf *KvFile) Close(sync bool) (err error) {
 		}
 	}
 
-	if kf.File != nil {
-		err = kf.File.Close()
+	// 先解除映射再关闭文件
+	if kf.Mp != nil {
+		if err = kf.Mp.Unmap(); err != nil {
+			return
+		}
 	}
 
-	if kf.Mp != nil {
-		err = kf.Mp.Flush()
+	if kf.File != nil {
+		err = kf.File.Close()
 	}
 	return
 }
@@ -199,7 +301,7 @@ func (kf *KvFile) Close(sync bool) (err error) {
 func Build(path string, method FileRwMethod, blockSize int64) (map[uint32]*KvFile, uint32, error)  {
 	dir, err := ioutil.ReadDir(path)
 	if err != nil {
-		return nil, 0, nil
+		return nil, 0, err
 	}
 
 	var activeFileId uint32 = 0
@@ -221,16 +323,32 @@ func Build(path string, method FileRwMethod, blockSize int64) (map[uint32]*KvFil
 			id := uint32(FileIds[i])
 			file, err := NewKvFile(path, id, method, blockSize)
 			if err != nil {
-				return nil, activeFileId, nil
+				return nil, activeFileId, err
 			}
 			archFiles[id] = file
 		}
+
+		// 活跃文件由调用方打开, 这里只检查文件头
+		if err := checkFileHeader(path, activeFileId, blockSize); err != nil {
+			return nil, activeFileId, err
+		}
 	}
 
 	// 返回
 	return archFiles, activeFileId, nil
 }
 
+// 检查数据文件的文件头
+func checkFileHeader(path string, fid uint32, blockSize int64) error {
+	filepath := path + PathSeparator + fmt.Sprintf(DbFileNameFormat, fid)
+	f, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-
-
+	if _, err := readFileHeader(f, fid, blockSize); err != nil {
+		return fmt.Errorf("%s: %w", filepath, err)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrAlreadyMigrated 数据文件已经是当前格式
+	ErrAlreadyMigrated = errors.New("data files are already in the current format")
+
+	// ErrMixedFormat 目录中同时存在新旧格式的数据文件
+	ErrMixedFormat = errors.New("directory contains data files in both legacy and current format")
+)
+
+const (
+	// MigrateBackupDir 升级前的数据文件移入该目录, 确认升级成功后可以删除
+	MigrateBackupDir = "legacy-backup"
+
+	// 升级过程中写入新文件的临时目录
+	migrateTmpDir = "migrate.tmp"
+
+	// 新文件全部写入完成的标记, 存在该标记时中断的升级可以继续完成替换
+	migrateDoneFile = "DONE"
+)
+
+// Migrate 将目录中没有文件头的旧格式数据文件升级为当前格式, 返回写入的entry数量
+// 所有entry按原来的顺序写入临时目录中的新文件, 全部写入并同步之后才替换旧文件,
+// 旧文件移入备份目录而不是直接删除; 替换过程中断时再次执行即可继续完成
+func Migrate(path string, blockSize int64) (int, error) {
+	tmp := path + PathSeparator + migrateTmpDir
+	backup := path + PathSeparator + MigrateBackupDir
+
+	// 上次升级在替换文件时中断
+	if _, err := os.Stat(tmp + PathSeparator + migrateDoneFile); err == nil {
+		return 0, replaceMigrated(path, tmp, backup)
+	}
+
+	ids, err := dataFileIds(path)
+	if err != nil {
+		return 0, err
+	}
+	legacy := 0
+	for _, id := range ids {
+		ok, err := isLegacyFile(path, id)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			legacy++
+		}
+	}
+	if legacy == 0 {
+		return 0, ErrAlreadyMigrated
+	}
+	if legacy != len(ids) {
+		return 0, ErrMixedFormat
+	}
+
+	// 重新建立临时目录
+	if err := os.RemoveAll(tmp); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(tmp, os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	// 按文件顺序依次读取entry写入新文件, 文件头占用了空间, 因此文件数量可能增加
+	var out *KvFile
+	var newId uint32
+	count := 0
+	for _, id := range ids {
+		old, err := OpenLegacyKvFile(path, id)
+		if err != nil {
+			return count, err
+		}
+
+		var offset int64 = 0
+		for {
+			e, err := old.Read(offset)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				old.Close(false)
+				return count, fmt.Errorf("%06d.data at offset %d: %w", id, offset, err)
+			}
+			if FileHeaderSize+int64(e.Size()) > blockSize {
+				old.Close(false)
+				return count, fmt.Errorf("%06d.data at offset %d: %w", id, offset, ErrEntryTooLarge)
+			}
+
+			// 当前文件剩余空间不足时写入下一个文件
+			if out == nil || out.Offset+int64(e.Size()) > blockSize {
+				if out != nil {
+					if err := out.Close(true); err != nil {
+						return count, err
+					}
+				}
+				if out, err = NewKvFile(tmp, newId, FileIO, blockSize); err != nil {
+					return count, err
+				}
+				newId++
+			}
+			if err := out.Write(e); err != nil {
+				return count, err
+			}
+			count++
+			offset += int64(e.Size())
+		}
+		if err := old.Close(false); err != nil {
+			return count, err
+		}
+	}
+	if out != nil {
+		if err := out.Close(true); err != nil {
+			return count, err
+		}
+	}
+
+	// 写入完成标记之后才开始替换旧文件
+	if err := ioutil.WriteFile(tmp+PathSeparator+migrateDoneFile, nil, FilePerm); err != nil {
+		return count, err
+	}
+	return count, replaceMigrated(path, tmp, backup)
+}
+
+// 将旧文件移入备份目录, 再将新文件移入数据库目录, 重复执行的结果相同
+func replaceMigrated(path, tmp, backup string) error {
+	if err := os.MkdirAll(backup, os.ModePerm); err != nil {
+		return err
+	}
+
+	// 移走旧格式的数据文件, 已经移入的新文件保留
+	ids, err := dataFileIds(path)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		ok, err := isLegacyFile(path, id)
+		if err != nil {
+			return err
+		}
+		if ok {
+			name := PathSeparator + fmt.Sprintf(DbFileNameFormat, id)
+			if err := os.Rename(path+name, backup+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 旧文件的索引文件和统计信息不再有效, 启动时重新生成
+	dir, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, d := range dir {
+		if strings.HasSuffix(d.Name(), ".hint") || strings.HasPrefix(d.Name(), StatsFileName) {
+			if err := os.Remove(path + PathSeparator + d.Name()); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 移入新文件
+	ids, err = dataFileIds(tmp)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		name := PathSeparator + fmt.Sprintf(DbFileNameFormat, id)
+		if err := os.Rename(tmp+name, path+name); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(tmp)
+}
+
+// 判断数据文件是否为没有文件头的旧格式
+func isLegacyFile(path string, fid uint32) (bool, error) {
+	f, err := os.Open(path + PathSeparator + fmt.Sprintf(DbFileNameFormat, fid))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, FileHeaderSize)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	_, err = DecodeFileHeader(buf[:n])
+	return err == ErrLegacyFormat, nil
+}
+
+// 返回目录中按顺序排列的数据文件id
+func dataFileIds(path string) ([]uint32, error) {
+	dir, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, d := range dir {
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".data") {
+			id, err := strconv.Atoi(strings.TrimSuffix(d.Name(), ".data"))
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	res := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, uint32(id))
+	}
+	return res, nil
+}
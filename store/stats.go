@@ -0,0 +1,69 @@
+package store
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// StatsFileName 数据文件统计信息的文件名
+	StatsFileName = "file.stats"
+
+	// 每条统计信息的大小: fid(4) + total(8) + garbage(8)
+	statsRecordSize = 20
+)
+
+// FileStat 数据文件中写入的数据大小和其中已经失效的数据大小
+type FileStat struct {
+	Total   int64
+	Garbage int64
+	// Untracked 失效时不会计入Garbage的数据大小, 重放时重新统计, 不保存
+	Untracked int64
+}
+
+// FileStats 数据文件id -> 统计信息
+type FileStats map[uint32]*FileStat
+
+// SaveFileStats 保存统计信息
+func (s FileStats) SaveFileStats(path string) error {
+	buf := make([]byte, 0, len(s)*statsRecordSize)
+	for fid, st := range s {
+		record := make([]byte, statsRecordSize)
+		binary.BigEndian.PutUint32(record[:4], fid)
+		binary.BigEndian.PutUint64(record[4:12], uint64(st.Total))
+		binary.BigEndian.PutUint64(record[12:20], uint64(st.Garbage))
+		buf = append(buf, record...)
+	}
+
+	// 先写入临时文件再重命名, 避免留下写了一半的统计信息
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, FilePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadFileStats 加载统计信息, 文件不存在时返回空的统计信息
+func LoadFileStats(path string) (FileStats, error) {
+	stats := make(FileStats)
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+
+	// 忽略末尾不完整的记录
+	for offset := 0; offset+statsRecordSize <= len(buf); offset += statsRecordSize {
+		fid := binary.BigEndian.Uint32(buf[offset : offset+4])
+		stats[fid] = &FileStat{
+			Total:   int64(binary.BigEndian.Uint64(buf[offset+4 : offset+12])),
+			Garbage: int64(binary.BigEndian.Uint64(buf[offset+12 : offset+20])),
+		}
+	}
+
+	// 返回
+	return stats, nil
+}
@@ -0,0 +1,56 @@
+package kvstore
+
+import (
+	"kvstore/cache"
+	"kvstore/index"
+)
+
+// 值不在索引表中时新建值缓存, 容量为0表示不缓存
+func newValueCache(config *Config) *cache.Cache {
+	if config.IdxMode == KeyValueMode || config.ValueCacheSize <= 0 {
+		return nil
+	}
+	return cache.New(config.ValueCacheSize, config.ValueCachePolicy)
+}
+
+// CacheStats 返回值缓存的统计信息, 没有启用值缓存时统计信息为空
+func (k *Kvstore) CacheStats() cache.Stats {
+	if k.values == nil {
+		return cache.Stats{}
+	}
+	return k.values.Stats()
+}
+
+// 从值缓存中查找索引信息指向的值, 缓存的值写入的位置需要一致
+func (k *Kvstore) cachedValue(idx *index.Indexer) ([]byte, bool) {
+	if k.values == nil {
+		return nil, false
+	}
+	return k.values.Get(string(idx.Meta.Key), entryPos{fid: idx.FileId, offset: idx.Offset})
+}
+
+// 将从文件读取的值放入值缓存, 每个键只缓存当前版本, 快照读取的历史版本不放入缓存
+func (k *Kvstore) cacheValue(idx *index.Indexer, value []byte) {
+	if k.values == nil {
+		return
+	}
+	current := k.strIndex.index.Get(idx.Meta.Key)
+	if current == nil || current.FileId != idx.FileId || current.Offset != idx.Offset {
+		return
+	}
+	k.values.Set(string(idx.Meta.Key), entryPos{fid: idx.FileId, offset: idx.Offset}, value)
+}
+
+// 键被修改, 删除或移动位置时从值缓存中删除, 调用方需持有字符串索引表的写锁
+func (k *Kvstore) invalidateValue(key []byte) {
+	if k.values != nil {
+		k.values.Remove(string(key))
+	}
+}
+
+// 清空值缓存, 重写数据文件之后所有位置都发生变化
+func (k *Kvstore) purgeValues() {
+	if k.values != nil {
+		k.values.Purge()
+	}
+}
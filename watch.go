@@ -0,0 +1,59 @@
+package kvstore
+
+// Watcher 监视一组键, 被监视的键在监视之后发生修改则Changed返回true
+// 所有的修改都会经过storeBatch写入文件, 因此在写入时检查被监视的键即可
+type Watcher struct {
+	kv      *Kvstore
+	keys    map[string]struct{}
+	changed bool
+}
+
+// NewWatcher 建立监视器
+func (k *Kvstore) NewWatcher() *Watcher {
+	return &Watcher{kv: k, keys: make(map[string]struct{})}
+}
+
+// Watch 监视给定的键
+func (w *Watcher) Watch(keys ...[]byte) {
+	k := w.kv
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, key := range keys {
+		w.keys[string(key)] = struct{}{}
+		if k.watchers[string(key)] == nil {
+			k.watchers[string(key)] = make(map[*Watcher]struct{})
+		}
+		k.watchers[string(key)][w] = struct{}{}
+	}
+}
+
+// Changed 判断被监视的键是否发生了修改
+func (w *Watcher) Changed() bool {
+	w.kv.mu.RLock()
+	defer w.kv.mu.RUnlock()
+	return w.changed
+}
+
+// Unwatch 取消监视所有的键, 并清除修改标记
+func (w *Watcher) Unwatch() {
+	k := w.kv
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for key := range w.keys {
+		delete(k.watchers[key], w)
+		if len(k.watchers[key]) == 0 {
+			delete(k.watchers, key)
+		}
+	}
+	w.keys = make(map[string]struct{})
+	w.changed = false
+}
+
+// 标记监视该键的监视器, 调用方需持有k.mu
+func (k *Kvstore) touch(key []byte) {
+	for w := range k.watchers[string(key)] {
+		w.changed = true
+	}
+}